@@ -2,6 +2,8 @@ package authorization
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
@@ -87,6 +89,33 @@ func (p *StaticPrincipal) GetGroupNames() []string {
 	return names
 }
 
+// ExpiringPrincipal is a StaticPrincipal authenticated by credentials that expire at a known time,
+// after which requests made on its behalf, such as long-lived streams, should end.
+type ExpiringPrincipal struct {
+	*StaticPrincipal
+	deadline time.Time
+}
+
+func NewExpiringPrincipal(principal *StaticPrincipal, deadline time.Time) *ExpiringPrincipal {
+	return &ExpiringPrincipal{principal, deadline}
+}
+
+// Deadline returns the time the principal's credentials expire. For principals authenticated by tokens accepted
+// for a time after their expiry to allow for clock skew, that's the end of that allowance.
+func (p *ExpiringPrincipal) Deadline() time.Time {
+	return p.deadline
+}
+
+// PrincipalDeadline returns the time the credentials authenticating principal expire.
+// The returned bool is false if principal has no such deadline.
+func PrincipalDeadline(principal Principal) (time.Time, bool) {
+	expiring, ok := principal.(interface{ Deadline() time.Time })
+	if !ok || expiring.Deadline().IsZero() {
+		return time.Time{}, false
+	}
+	return expiring.Deadline(), true
+}
+
 // GetPrincipal returns the principal (e.g., a user) contained in a context.
 // The principal is assumed to be stored as a ctx.Value.
 // If no principal can be found, a principal representing an anonymous (unauthenticated) user is returned.
@@ -110,6 +139,27 @@ type AuthService interface {
 	Authenticate(ctx context.Context) (Principal, error)
 }
 
+// PrioritizedAuthService is an AuthService along with its priority relative to other services.
+type PrioritizedAuthService struct {
+	AuthService
+	Priority int
+}
+
+// SortAuthServicesByPriority returns the given services ordered from highest to lowest priority,
+// as expected by CreateMiddlewareAuthFunction. Services with equal priority keep their relative order.
+func SortAuthServicesByPriority(services []PrioritizedAuthService) []AuthService {
+	sorted := make([]PrioritizedAuthService, len(services))
+	copy(sorted, services)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	authServices := make([]AuthService, 0, len(sorted))
+	for _, service := range sorted {
+		authServices = append(authServices, service.AuthService)
+	}
+	return authServices
+}
+
 // CreateMiddlewareAuthFunction returns an authentication function that combines the given
 // authentication services. That function returns success if any service successfully
 // authenticates the user, and an error if all services fail to authenticate.
@@ -26,6 +26,33 @@ func TestCreateMiddlewareAuthFunction(t *testing.T) {
 	assert.NotNil(t, e, "no credentials should result in error")
 }
 
+func TestCreateMiddlewareAuthFunction_Priority(t *testing.T) {
+	kubernetesPrincipal := NewStaticPrincipal("kubernetes-user", []string{"group"})
+	basicPrincipal := NewStaticPrincipal("basic-user", []string{"group"})
+	services := SortAuthServicesByPriority([]PrioritizedAuthService{
+		{AuthService: &fakeAuthService{basicPrincipal, nil}},
+		{AuthService: &fakeAuthService{nil, missingCredentials}, Priority: 20},
+		{AuthService: &fakeAuthService{kubernetesPrincipal, nil}, Priority: 10},
+	})
+
+	c, e := CreateMiddlewareAuthFunction(services)(context.Background())
+	assert.Nil(t, e)
+	assert.Equal(t, kubernetesPrincipal, GetPrincipal(c), "higher-priority service should authenticate the request")
+}
+
+func TestSortAuthServicesByPriority_StableForEqualPriorities(t *testing.T) {
+	first := &fakeAuthService{nil, errors.New("first")}
+	second := &fakeAuthService{nil, errors.New("second")}
+	third := &fakeAuthService{nil, errors.New("third")}
+
+	sorted := SortAuthServicesByPriority([]PrioritizedAuthService{
+		{AuthService: first},
+		{AuthService: second, Priority: -1},
+		{AuthService: third},
+	})
+	assert.Equal(t, []AuthService{first, third, second}, sorted)
+}
+
 type fakeAuthService struct {
 	principal Principal
 	err       error
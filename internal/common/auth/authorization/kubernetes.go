@@ -1,178 +1,1332 @@
 package authorization
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/clock"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	authv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 
 	"github.com/G-Research/armada/internal/common/auth/configuration"
+	"github.com/G-Research/armada/internal/common/util"
 )
 
 type TokenReviewer interface {
 	ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error)
 }
 
-type KubernetesTokenReviewer struct{}
+// KubernetesTokenReviewer reviews tokens against the cluster that issued them. Clientsets are pooled per
+// cluster, CA and client certificate, keyed on the canonical form of the cluster URL. Since CAs are supplied
+// by clients, the pool is bounded, dropping the least recently used clientset once MaxClientSets is reached.
+type KubernetesTokenReviewer struct {
+	// Maximum number of clientsets pooled. Defaults to 256 if zero.
+	MaxClientSets int
+	// Timeout of TokenReview requests. Defaults to 30 seconds if zero.
+	Timeout time.Duration
+
+	mutex      sync.Mutex
+	clientSets *lru.Cache
+}
 
 func (reviewer *KubernetesTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
-	config := &rest.Config{
-		Host:            clusterUrl,
-		BearerToken:     token,
-		TLSClientConfig: rest.TLSClientConfig{CAData: ca},
-	}
-	clientSet, err := kubernetes.NewForConfig(config)
+	clientSet, err := reviewer.clientSet(clusterUrl, ca, TokenReviewClientCertificate(ctx))
 	if err != nil {
 		return &authv1.TokenReview{}, err
 	}
 
 	tr := authv1.TokenReview{
 		Spec: authv1.TokenReviewSpec{
-			Token: token,
+			Token:     token,
+			Audiences: TokenReviewAudiences(ctx),
 		},
 	}
 
-	return clientSet.AuthenticationV1().TokenReviews().Create(ctx, &tr, metav1.CreateOptions{})
+	tokenReviewTokenBytes.Observe(float64(len(tr.Spec.Token)))
+	result, err := clientSet.AuthenticationV1().TokenReviews().Create(withBearerToken(ctx, token), &tr, metav1.CreateOptions{})
+	if err == nil && result != nil {
+		tokenReviewResponseBytes.Observe(float64(result.Status.Size()))
+	}
+	return result, err
+}
+
+type tokenReviewAudiencesKey struct{}
+
+// WithTokenReviewAudiences returns a child context requesting that token reviews made with it
+// validate the token against the given audiences.
+func WithTokenReviewAudiences(ctx context.Context, audiences []string) context.Context {
+	return context.WithValue(ctx, tokenReviewAudiencesKey{}, audiences)
+}
+
+// TokenReviewAudiences returns the audiences attached to ctx by WithTokenReviewAudiences.
+func TokenReviewAudiences(ctx context.Context) []string {
+	audiences, _ := ctx.Value(tokenReviewAudiencesKey{}).([]string)
+	return audiences
 }
 
+var errTokenExpiryNotSet = errors.New("token expiry time not set")
+
+// errTokenExpired is returned for tokens whose exp claim has passed.
+var errTokenExpired = &tokenRejectedError{"invalid token, expired"}
+
+// errTokenNotYetValid is returned for tokens whose nbf claim hasn't yet been reached.
+var errTokenNotYetValid = &tokenRejectedError{"invalid token, not yet valid"}
+
+// errTokenIssuedInFuture is returned for tokens whose iat claim is further in the future than MaxIssuedAtSkew allows,
+// which indicates either a badly skewed issuer clock or a forged token.
+var errTokenIssuedInFuture = &tokenRejectedError{"invalid token, issued too far in the future"}
+
+// Time for which tokens without an exp claim are cached if NonExpiringTokenCacheTTL isn't set.
+const defaultNonExpiringTokenCacheTTL = 5 * time.Minute
+
+// Authorization scheme identifying KubernetesAuth credentials.
+const kubernetesAuthScheme = "KubernetesAuth"
+
+// Metadata key from which credentials are read if no other key is configured.
+const defaultKubernetesAuthMetadataKey = "authorization"
+
 type KubernetesNativeAuthService struct {
 	KidMappingFileLocation string
-	TokenCache             *cache.Cache
-	InvalidTokenExpiry     int64
-	TokenReviewer          TokenReviewer
-	Clock                  clock.Clock
+	// Source of kid to cluster URL mappings. If nil, one file per kid is read from KidMappingFileLocation.
+	KidMappingSource KidMappingSource
+	// Checks the kid of each token is acceptable before it's used. If nil, kids must be non-empty
+	// and mustn't contain "../".
+	KidValidator func(kid string) error
+	// If true, token headers containing fields other than the registered JOSE header parameters are rejected.
+	StrictTokenHeader bool
+	// If non-empty, tokens whose header has a typ other than one of these are rejected. Tokens without a typ
+	// are accepted.
+	AllowedTokenTypes []string
+	// Prefix stripped from token kids before looking up their mapping file. Kids lacking it are rejected.
+	KidPrefix string
+	// If set, kids of the form "<cluster><separator><key id>" are looked up by their cluster part alone.
+	KidSeparator string
+	// If true, tokens without a kid are reviewed against DefaultClusterURL rather than being rejected.
+	AllowTokensWithoutKid bool
+	DefaultClusterURL     string
+	// gRPC metadata key holding the KubernetesAuth credentials. Defaults to "authorization" if empty.
+	MetadataKey string
+	TokenCache  *cache.Cache
+	// How long rejected tokens are cached for, in nanoseconds. Zero or negative disables caching of rejected
+	// tokens, so that every attempt to use one is reviewed. Read atomically, so that it can be changed
+	// at runtime with SetInvalidTokenExpiry.
+	InvalidTokenExpiry int64
+	// Tokens issued (iat) further than this into the future are rejected. Zero disables the check.
+	MaxIssuedAtSkew time.Duration
+	// Allowance for clock skew between issuers and this server when checking nbf and exp claims.
+	ClockSkewLeeway time.Duration
+	// If true, usernames of the form "user|group1,group2" are split into a name and groups.
+	SplitUsernameGroups bool
+	// If true, groups returned by TokenReview are added to the principal's groups. Otherwise they're ignored.
+	UseTokenReviewGroups bool
+	// Groups given to principals for which no groups from TokenReview are used.
+	DefaultGroups []string
+	// If true, the principal's name isn't added to its groups.
+	ExcludeUsernameFromGroups bool
+	// If true, panics while authenticating are not recovered from.
+	DisablePanicRecovery bool
+	// If true, tokens without an exp claim are accepted, with the result of reviewing them cached for
+	// NonExpiringTokenCacheTTL, or 5 minutes if that's not set.
+	AllowNonExpiringTokens   bool
+	NonExpiringTokenCacheTTL time.Duration
+	// Cached tokens accessed when closer than this to expiry are synchronously reviewed again. Zero disables refreshes.
+	CacheRefreshThreshold time.Duration
+	// Audiences tokens are reviewed against. If non-empty, TokenReview must confirm at least one of them.
+	Audiences []string
+	// If true, Audiences may be overridden per kid by ".audiences" files in KidMappingFileLocation.
+	PerKidAudiences bool
+	// If true, TokenReviews for a kid present the client certificate in the ".crt" and ".key" files
+	// alongside its mapping in KidMappingFileLocation, if any.
+	PerKidClientCertificates bool
+	// If true, cache entries are keyed by the cluster tokens were reviewed against as well as the token,
+	// so that InvalidateCluster can precisely remove every entry for a cluster, including rejections.
+	// Looking tokens up in the cache then requires resolving their cluster.
+	CacheByCluster bool
+	// If non-nil, concurrent reviews of the same token are coalesced into a single TokenReview.
+	ReviewGroup *singleflight.Group
+	// Maximum duration of a coalesced review, which isn't bound by the deadline of any one caller.
+	// Defaults to 30 seconds if zero.
+	TokenReviewTimeout time.Duration
+	// If non-nil, token signatures are verified against pinned JWKS files before being reviewed.
+	JWKSVerifier *StaticJWKSVerifier
+	// If non-empty, only service accounts in these namespaces are accepted, and users that aren't service
+	// accounts are rejected.
+	AllowedNamespaces []string
+	// Optional check run after a successful TokenReview. If it returns an error, the request is rejected
+	// and the user isn't cached.
+	PostAuthHook func(ctx context.Context, user authv1.UserInfo) error
+	// Deduplicates usernames and groups shared by cache entries. May be nil, in which case they aren't deduplicated.
+	interner *stringInterner
+	// Notified when entries leave TokenCache. May be nil, in which case evictions aren't observed.
+	CacheEvictions *CacheEvictionObserver
+	// Receives an event for every authentication decision. May be nil.
+	AuditSink AuditSink
+	// Counts hits and misses of TokenCache, as reported by CacheStats. May be nil, in which case none are counted.
+	CacheLookups *CacheLookupCounter
+	// Tracks the kids recently used to authenticate. May be nil, in which case no activity is tracked.
+	KidActivity *KidActivityTracker
+	// Caps the number of distinct clusters tokens are reviewed against. May be nil, in which case there's no cap.
+	ClusterLimiter *ClusterLimiter
+	// Cancels in-flight reviews when Stop is called. May be nil, in which case Stop does nothing.
+	shutdown *reviewShutdown
+	// Sampler started by StartTokenCacheSampler, stopped by Stop. Nil if none has been started.
+	tokenCacheSampler *TokenCacheSampler
+	TokenReviewer     TokenReviewer
+	Clock             clock.Clock
+}
+
+// KubernetesAuthOption customises a KubernetesNativeAuthService beyond what can be configured.
+type KubernetesAuthOption func(authService *KubernetesNativeAuthService)
+
+// WithKidValidator replaces the default check applied to token kids with validator,
+// e.g., to only accept kids matching a deployment-specific pattern.
+func WithKidValidator(validator func(kid string) error) KubernetesAuthOption {
+	return func(authService *KubernetesNativeAuthService) {
+		authService.KidValidator = validator
+	}
 }
 
-func NewKubernetesNativeAuthService(config configuration.KubernetesAuthConfig) KubernetesNativeAuthService {
+func NewKubernetesNativeAuthService(config configuration.KubernetesAuthConfig, opts ...KubernetesAuthOption) KubernetesNativeAuthService {
+	cacheEvictions := &CacheEvictionObserver{}
 	cache := cache.New(5*time.Minute, 5*time.Minute)
-	return KubernetesNativeAuthService{
-		KidMappingFileLocation: config.KidMappingFileLocation,
-		TokenCache:             cache,
-		InvalidTokenExpiry:     config.InvalidTokenExpiry,
-		TokenReviewer:          &KubernetesTokenReviewer{},
-		Clock:                  clock.RealClock{},
+	cache.OnEvicted(cacheEvictions.onEvicted)
+	var reviewer TokenReviewer = NewInstrumentedTokenReviewer(&KubernetesTokenReviewer{Timeout: config.TokenReviewTimeout})
+	if config.TokenReviewMaxAttempts > 1 {
+		reviewer = NewRetryingTokenReviewer(reviewer, config.TokenReviewMaxAttempts, config.TokenReviewRetryBackoff, clock.RealClock{})
+	}
+	if config.CircuitBreakerFailureThreshold > 0 {
+		reviewer = NewCircuitBreakingTokenReviewer(
+			reviewer, config.CircuitBreakerFailureThreshold, config.CircuitBreakerCooldown, clock.RealClock{})
+	}
+	var kidMappingSource KidMappingSource = NewDirectoryKidMappingSource(config.KidMappingFileLocation)
+	if config.KidMappingMode == KidMappingModeFile {
+		kidMappingSource = NewFileKidMappingSource(config.KidMappingFileLocation)
+	}
+	var jwksVerifier *StaticJWKSVerifier
+	if config.VerifyWithStaticJWKS {
+		jwksVerifier = NewStaticJWKSVerifier(config.KidMappingFileLocation)
+	}
+	var clusterLimiter *ClusterLimiter
+	if config.MaxDistinctClusters > 0 {
+		clusterLimiter = NewClusterLimiter(config.MaxDistinctClusters)
 	}
+	authService := KubernetesNativeAuthService{
+		KidMappingFileLocation:    config.KidMappingFileLocation,
+		KidMappingSource:          kidMappingSource,
+		KidPrefix:                 config.KidPrefix,
+		KidSeparator:              config.KidSeparator,
+		AllowTokensWithoutKid:     config.AllowTokensWithoutKid,
+		DefaultClusterURL:         config.DefaultClusterURL,
+		StrictTokenHeader:         config.StrictTokenHeader,
+		AllowedTokenTypes:         config.AllowedTokenTypes,
+		MetadataKey:               config.MetadataKey,
+		TokenCache:                cache,
+		CacheEvictions:            cacheEvictions,
+		interner:                  newStringInterner(),
+		InvalidTokenExpiry:        config.InvalidTokenExpiry,
+		MaxIssuedAtSkew:           config.MaxIssuedAtSkew,
+		ClockSkewLeeway:           config.ClockSkewLeeway,
+		SplitUsernameGroups:       config.SplitUsernameGroups,
+		UseTokenReviewGroups:      config.UseTokenReviewGroups,
+		DefaultGroups:             config.DefaultGroups,
+		ExcludeUsernameFromGroups: config.ExcludeUsernameFromGroups,
+		DisablePanicRecovery:      config.DisablePanicRecovery,
+		CacheRefreshThreshold:     config.CacheRefreshThreshold,
+		AllowNonExpiringTokens:    config.AllowNonExpiringTokens,
+		NonExpiringTokenCacheTTL:  config.NonExpiringTokenCacheTTL,
+		JWKSVerifier:              jwksVerifier,
+		ReviewGroup:               &singleflight.Group{},
+		TokenReviewTimeout:        config.TokenReviewTimeout,
+		Audiences:                 config.Audiences,
+		PerKidAudiences:           config.PerKidAudiences,
+		PerKidClientCertificates:  config.PerKidClientCertificates,
+		AllowedNamespaces:         config.AllowedNamespaces,
+		CacheByCluster:            config.CacheByCluster,
+		CacheLookups:              &CacheLookupCounter{},
+		KidActivity:               NewKidActivityTracker(kidActivityWindow, clock.RealClock{}),
+		ClusterLimiter:            clusterLimiter,
+		shutdown:                  newReviewShutdown(),
+		TokenReviewer:             reviewer,
+		Clock:                     clock.RealClock{},
+	}
+	for _, opt := range opts {
+		opt(&authService)
+	}
+	return authService
+}
+
+// NewKubernetesNativeAuthServiceWithError is like NewKubernetesNativeAuthService,
+// but first validates config, returning an error if it's invalid.
+func NewKubernetesNativeAuthServiceWithError(config configuration.KubernetesAuthConfig, opts ...KubernetesAuthOption) (KubernetesNativeAuthService, error) {
+	if err := validateKubernetesAuthConfig(config); err != nil {
+		return KubernetesNativeAuthService{}, err
+	}
+	return NewKubernetesNativeAuthService(config, opts...), nil
+}
+
+func validateKubernetesAuthConfig(config configuration.KubernetesAuthConfig) error {
+	if config.KidMappingFileLocation == "" {
+		return fmt.Errorf("invalid kubernetes auth config: KidMappingFileLocation must not be empty")
+	}
+	info, err := os.Stat(config.KidMappingFileLocation)
+	if err != nil {
+		return fmt.Errorf("invalid kubernetes auth config: KidMappingFileLocation is unreadable: %s", err)
+	}
+	switch config.KidMappingMode {
+	case "", KidMappingModeDirectory:
+		if !info.IsDir() {
+			return fmt.Errorf("invalid kubernetes auth config: KidMappingFileLocation %s is not a directory", config.KidMappingFileLocation)
+		}
+	case KidMappingModeFile:
+		if info.IsDir() {
+			return fmt.Errorf("invalid kubernetes auth config: KidMappingFileLocation %s is a directory", config.KidMappingFileLocation)
+		}
+		// These read files alongside each kid's mapping file, so need a kid mapping directory.
+		switch {
+		case config.PerKidAudiences:
+			return fmt.Errorf("invalid kubernetes auth config: PerKidAudiences requires KidMappingMode %s", KidMappingModeDirectory)
+		case config.VerifyWithStaticJWKS:
+			return fmt.Errorf("invalid kubernetes auth config: VerifyWithStaticJWKS requires KidMappingMode %s", KidMappingModeDirectory)
+		case config.PerKidClientCertificates:
+			return fmt.Errorf("invalid kubernetes auth config: PerKidClientCertificates requires KidMappingMode %s", KidMappingModeDirectory)
+		}
+	default:
+		return fmt.Errorf("invalid kubernetes auth config: unknown KidMappingMode %s", config.KidMappingMode)
+	}
+	if config.AllowTokensWithoutKid {
+		if _, err := canonicalizeClusterURL(config.DefaultClusterURL); err != nil {
+			return fmt.Errorf("invalid kubernetes auth config: AllowTokensWithoutKid requires a valid DefaultClusterURL: %s", err)
+		}
+	}
+	return nil
+}
+
+type tokenCacheBypassKey struct{}
+
+// WithTokenCacheBypass returns a child context for which KubernetesNativeAuthService.Authenticate ignores
+// cached results and always performs a fresh TokenReview. The result of that review is still cached.
+// Intended for debugging the authentication of individual requests.
+func WithTokenCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tokenCacheBypassKey{}, true)
+}
+
+func isTokenCacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(tokenCacheBypassKey{}).(bool)
+	return bypass
+}
+
+type incomingTrailerKey struct{}
+
+// WithIncomingTrailer returns a child context carrying the trailer metadata sent by the client.
+// Some proxies forward credentials in HTTP/2 trailers rather than headers. gRPC doesn't expose request trailers
+// to handlers, so a transport-level component with access to them must attach them using this function for
+// KubernetesNativeAuthService to fall back to them when no credentials header is present.
+func WithIncomingTrailer(ctx context.Context, trailer metadata.MD) context.Context {
+	return context.WithValue(ctx, incomingTrailerKey{}, trailer)
+}
+
+func incomingTrailer(ctx context.Context) metautils.NiceMD {
+	trailer, ok := ctx.Value(incomingTrailerKey{}).(metadata.MD)
+	if !ok {
+		return metautils.NiceMD{}
+	}
+	return metautils.NiceMD(trailer)
 }
 
 type CacheData struct {
-	Name  string `json:"name"`
-	Valid bool   `json:"valid"`
+	Name       string   `json:"name"`
+	Groups     []string `json:"groups"`
+	Kid        string   `json:"kid"`
+	ClusterURL string   `json:"clusterUrl"`
+	Valid      bool     `json:"valid"`
+	// Time the entry was last refreshed; see CacheRefreshThreshold. Zero if it never has been.
+	RefreshedAt time.Time `json:"refreshedAt"`
+}
+
+// TokenInfo describes the token a Principal was authenticated with.
+type TokenInfo struct {
+	Kid        string
+	ClusterURL string
+	// For tokens without an exp claim, the time the result of authenticating them expires from the cache.
+	Expiry time.Time
+	// True if the principal was served from the token cache rather than a fresh TokenReview.
+	FromCache bool
+	// Groups returned by TokenReview for the token's user.
+	Groups []string
+}
+
+// AuthenticateGRPC is like Authenticate, except that errors are returned as gRPC status errors: InvalidArgument
+// for missing or malformed credentials, Unauthenticated for tokens that are expired or otherwise rejected,
+// Canceled or DeadlineExceeded if ctx is done, Unavailable if reviewing the token failed temporarily, e.g. because
+// retries were exhausted, and Internal if the token couldn't otherwise be reviewed.
+func (authService *KubernetesNativeAuthService) AuthenticateGRPC(ctx context.Context) (Principal, error) {
+	principal, err := authService.Authenticate(ctx)
+	if err != nil {
+		return nil, grpcStatusError(err)
+	}
+	return principal, nil
+}
+
+func grpcStatusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var rejected *tokenRejectedError
+	var malformed *malformedTokenError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.As(err, &malformed):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &rejected) || errors.Is(err, errTokenExpiryNotSet) || errors.Is(err, errNoKidMapping):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case IsTemporary(err):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
 }
 
+// Authenticate authenticates the KubernetesAuth credentials contained in ctx.
 func (authService *KubernetesNativeAuthService) Authenticate(ctx context.Context) (Principal, error) {
+	principal, _, err := authService.AuthenticateWithInfo(ctx)
+	return principal, err
+}
+
+// AuthenticateWithInfo authenticates the KubernetesAuth credentials contained in ctx,
+// returning details of the token used alongside the Principal.
+func (authService *KubernetesNativeAuthService) AuthenticateWithInfo(ctx context.Context) (Principal, TokenInfo, error) {
+	principal, info, _, err := authService.recoveringAuthenticate(ctx)
+	return principal, info, err
+}
+
+// AuthenticateRaw authenticates the KubernetesAuth credentials contained in ctx, returning the TokenReview
+// performed alongside the Principal, for callers needing fields not otherwise surfaced, such as Extra.
+// The TokenReview is nil if the result came from the cache. Its Spec.Token is cleared, so that it can be
+// safely logged.
+func (authService *KubernetesNativeAuthService) AuthenticateRaw(ctx context.Context) (Principal, *authv1.TokenReview, error) {
+	principal, _, review, err := authService.recoveringAuthenticate(ctx)
+	return principal, review, err
+}
+
+// recoveringAuthenticate calls authenticate. Unless DisablePanicRecovery is set, a panic while processing
+// credentials is recovered from and reported as a rejection, so that a single malformed token can't take
+// down the server.
+//
+// The outcome is reported to AuditSink, if set, and failures are counted by kid and reason.
+func (authService *KubernetesNativeAuthService) recoveringAuthenticate(ctx context.Context) (principal Principal, info TokenInfo, review *authv1.TokenReview, err error) {
+	var attempt authAttempt
+	// Deferred first, so that it runs after any panic has been recovered from.
+	defer func() {
+		authService.audit(ctx, principal, info, attempt.token, err)
+		if err != nil && err != missingCredentials {
+			recordAuthFailure(kidForReporting(attempt.token), attempt.kidResolved, err)
+		}
+	}()
+	if !authService.DisablePanicRecovery {
+		defer func() {
+			if r := recover(); r != nil {
+				authPanicsTotal.Inc()
+				log.Errorf("recovered from panic while authenticating kubernetes token: %v", r)
+				principal, info, review, err = nil, TokenInfo{}, nil, &tokenRejectedError{"failed to process kubernetes auth credentials"}
+			}
+		}()
+	}
+	return authService.authenticate(ctx, &attempt)
+}
+
+// authAttempt records what authenticate learnt about the credentials it was given, so that its outcome can be
+// reported without parsing them or resolving their kid again.
+type authAttempt struct {
+	// The token, once parsed.
+	token string
+	// Set once the token's kid has been found in the kid mapping. Tokens found in the cache, including
+	// rejected ones, had their kid found when they were reviewed.
+	kidResolved bool
+}
+
+// authenticate authenticates the credentials in ctx, recording what it learns about them in attempt.
+func (authService *KubernetesNativeAuthService) authenticate(ctx context.Context, attempt *authAttempt) (Principal, TokenInfo, *authv1.TokenReview, error) {
 	// Retrieve token from context.
-	authHeader := strings.SplitN(metautils.ExtractIncoming(ctx).Get("authorization"), " ", 2)
+	authHeader := strings.SplitN(authService.authHeaderValue(ctx), " ", 2)
 
-	if len(authHeader) < 2 || authHeader[0] != "KubernetesAuth" {
-		return nil, missingCredentials
+	if len(authHeader) < 2 || authHeader[0] != kubernetesAuthScheme {
+		return nil, TokenInfo{}, nil, missingCredentials
 	}
 
-	token, ca, err := parseAuth(authHeader[1])
+	token, ca, err := parseAuth(strings.TrimSpace(authHeader[1]))
 	if err != nil {
-		return nil, missingCredentials
+		return nil, TokenInfo{}, nil, missingCredentials
 	}
+	if err := checkPlausibleJWT(token); err != nil {
+		return nil, TokenInfo{}, nil, err
+	}
+	attempt.token = token
 
 	// Get token time
-	expirationTime, err := parseTime(token)
+	claims, err := parseClaims(token)
 	if err != nil {
-		return nil, err
+		return nil, TokenInfo{}, nil, &malformedTokenError{err.Error()}
+	}
+	expirationTime, err := authService.expirationTime(claims)
+	if err != nil {
+		return nil, TokenInfo{}, nil, err
 	}
 
-	if authService.Clock.Now().After(expirationTime) {
-		return nil, fmt.Errorf("invalid token, expired")
+	if err := ValidateTemporalClaims(claims.TemporalClaims, authService.Clock.Now(), authService.ClockSkewLeeway, authService.MaxIssuedAtSkew); err != nil {
+		return nil, TokenInfo{}, nil, err
 	}
 
 	// Check Cache
-	data, found := authService.TokenCache.Get(token)
-	if found {
-		if cacheInfo, ok := data.(CacheData); ok {
-			if cacheInfo.Valid {
-				return NewStaticPrincipal(cacheInfo.Name, []string{cacheInfo.Name}), nil
+	if !isTokenCacheBypassed(ctx) {
+		key, err := authService.lookupCacheKey(token)
+		if err != nil {
+			return nil, TokenInfo{}, nil, err
+		}
+		data, found := authService.TokenCache.Get(key)
+		cacheInfo, ok := data.(CacheData)
+		authService.CacheLookups.Record(found && ok)
+		attempt.kidResolved = found && ok
+		if found {
+			if !ok {
+				// Treat entries of the wrong type as misses, removing them so that they're replaced.
+				log.Warnf("removing token cache entry of unexpected type %T", data)
+				tokenCacheCorruptEntriesTotal.Inc()
+				authService.invalidate(key)
+			} else if cacheInfo.Valid {
+				result := reviewResult{cacheInfo: cacheInfo}
+				fromCache := true
+				if authService.shouldRefresh(expirationTime, cacheInfo) {
+					result, fromCache, err = authService.refresh(ctx, key, token, ca, expirationTime, cacheInfo)
+					if err != nil {
+						return nil, TokenInfo{}, nil, err
+					}
+				}
+				cacheInfo = result.cacheInfo
+				authService.KidActivity.Record(cacheInfo.Kid, cacheInfo.ClusterURL)
+				return authService.principalFromUser(cacheInfo.Name, cacheInfo.Groups, claims.Expiry), tokenInfo(cacheInfo, expirationTime, fromCache), result.review, nil
 			} else {
-				return nil, fmt.Errorf("token invalid")
+				return nil, TokenInfo{}, nil, &tokenRejectedError{"token invalid"}
+			}
+		}
+	}
+
+	result, err := authService.coalescedReviewAndCache(ctx, token, ca, expirationTime)
+	attempt.kidResolved = result.kidResolved
+	if err != nil {
+		return nil, TokenInfo{}, nil, err
+	}
+	cacheInfo := result.cacheInfo
+	authService.KidActivity.Record(cacheInfo.Kid, cacheInfo.ClusterURL)
+
+	// Return very basic Principal
+	return authService.principalFromUser(cacheInfo.Name, cacheInfo.Groups, claims.Expiry), tokenInfo(cacheInfo, expirationTime, false), result.review, nil
+}
+
+func tokenInfo(cacheInfo CacheData, expirationTime time.Time, fromCache bool) TokenInfo {
+	return TokenInfo{
+		Kid:        cacheInfo.Kid,
+		ClusterURL: cacheInfo.ClusterURL,
+		Expiry:     expirationTime,
+		FromCache:  fromCache,
+		Groups:     cacheInfo.Groups,
+	}
+}
+
+// coalescedReviewAndCache calls reviewAndCache, sharing a single review between concurrent callers for the same token
+// and CA. The shared review isn't cancelled when any one caller's context is; instead, each caller stops waiting for
+// it as soon as its own context is done, while the review continues for the benefit of the others until it
+// completes or TokenReviewTimeout elapses.
+func (authService *KubernetesNativeAuthService) coalescedReviewAndCache(ctx context.Context, token string, ca string, expirationTime time.Time) (reviewResult, error) {
+	if authService.ReviewGroup == nil {
+		return authService.reviewAndCache(ctx, token, ca, expirationTime)
+	}
+
+	// The CA is part of the key so that a caller supplying a different CA doesn't get the result of a review
+	// made trusting another caller's.
+	caFingerprint := sha256.Sum256([]byte(ca))
+	key := authService.tokenCacheKey(token) + "|" + hex.EncodeToString(caFingerprint[:])
+	results := authService.ReviewGroup.DoChan(key, func() (result interface{}, err error) {
+		// DoChan re-panics in a goroutine of its own, where the panic can't be recovered from, so panics are
+		// instead passed to the callers waiting on the review, which panic in turn.
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = nil, &coalescedReviewPanic{value: r}
 			}
+		}()
+		reviewCtx, cancel := context.WithTimeout(detachedContext{ctx}, authService.tokenReviewTimeout())
+		defer cancel()
+		return authService.reviewAndCache(reviewCtx, token, ca, expirationTime)
+	})
+	select {
+	case result := <-results:
+		var panicked *coalescedReviewPanic
+		if errors.As(result.Err, &panicked) {
+			panic(panicked.value)
 		}
+		reviewed, _ := result.Val.(reviewResult)
+		return reviewed, result.Err
+	case <-ctx.Done():
+		return reviewResult{}, ctx.Err()
 	}
+}
+
+// coalescedReviewPanic carries a panic out of a coalesced review to the callers waiting on it.
+type coalescedReviewPanic struct {
+	value interface{}
+}
+
+func (err *coalescedReviewPanic) Error() string {
+	return fmt.Sprintf("panic during coalesced token review: %v", err.value)
+}
+
+// Timeout of TokenReviews if none is configured.
+const defaultTokenReviewTimeout = 30 * time.Second
+
+func (authService *KubernetesNativeAuthService) tokenReviewTimeout() time.Duration {
+	if authService.TokenReviewTimeout > 0 {
+		return authService.TokenReviewTimeout
+	}
+	return defaultTokenReviewTimeout
+}
+
+// detachedContext carries the values of its parent but is never cancelled and has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (ctx detachedContext) Done() <-chan struct{}             { return nil }
+func (ctx detachedContext) Err() error                        { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{} { return ctx.parent.Value(key) }
 
+// reviewResult is the outcome of reviewing a token.
+type reviewResult struct {
+	cacheInfo CacheData
+	// The TokenReview performed, with its Spec.Token cleared. Nil if no review was performed.
+	review *authv1.TokenReview
+	// Set if the token's kid was found in the kid mapping, even if the review then failed.
+	kidResolved bool
+}
+
+// reviewAndCache reviews token against the cluster that issued it and caches the resulting user until expirationTime.
+// Once the token's kid has been found in the kid mapping, the result is marked as such, even if it's returned with
+// an error.
+func (authService *KubernetesNativeAuthService) reviewAndCache(ctx context.Context, token string, ca string, expirationTime time.Time) (result reviewResult, err error) {
 	// Get URL from token KID
-	url, err := authService.getClusterURL(token)
+	kid, err := authService.tokenKid(token)
 	if err != nil {
-		return nil, err
+		return reviewResult{}, err
+	}
+	url, err := authService.clusterURLForKid(kid)
+	if err != nil {
+		return reviewResult{}, err
+	}
+	defer func() {
+		result.kidResolved = true
+	}()
+
+	// Verify the signature locally against pinned keys, if configured, before asking the cluster.
+	if authService.JWKSVerifier != nil {
+		if err := authService.verifyWithStaticJWKS(kid, token); err != nil {
+			return reviewResult{}, err
+		}
 	}
 
 	// Make request to token review endpoint
-	name, err := authService.reviewToken(ctx, url, token, []byte(ca))
+	audiences, err := authService.audiencesForKid(kid)
 	if err != nil {
-		return nil, err
+		return reviewResult{}, err
+	}
+	cert, err := authService.clientCertificateForKid(kid)
+	if err != nil {
+		return reviewResult{}, err
+	}
+	if cert != nil {
+		ctx = WithTokenReviewClientCertificate(ctx, cert)
+	}
+	review, err := authService.reviewToken(ctx, url, token, []byte(ca), audiences)
+	if err != nil {
+		return reviewResult{}, err
+	}
+	user := review.Status.User
+	if user.Username == "" {
+		// Fall back to the token's subject if TokenReview didn't say who the user is.
+		claims, err := parseClaims(token)
+		if err != nil {
+			return reviewResult{}, err
+		}
+		if claims.Subject == "" {
+			return reviewResult{}, &tokenRejectedError{"TokenReview returned no username and the token has no sub claim"}
+		}
+		user.Username = claims.Subject
+	}
+
+	// Enforce any additional policy before the user is cached.
+	if err := authService.checkServiceAccountNamespace(user.Username); err != nil {
+		return reviewResult{}, err
+	}
+	if authService.PostAuthHook != nil {
+		if err := authService.PostAuthHook(ctx, user); err != nil {
+			return reviewResult{}, &tokenRejectedError{fmt.Sprintf("token rejected by post-authentication check: %s", err)}
+		}
 	}
 
 	// Add to cache
-	authService.TokenCache.Set(
-		token,
-		CacheData{
-			Name:  name,
-			Valid: true,
-		},
-		expirationTime.Sub(time.Now()))
+	cacheInfo := CacheData{
+		Name:       authService.interner.intern(user.Username),
+		Groups:     authService.interner.internAll(user.Groups),
+		Kid:        kid,
+		ClusterURL: url,
+		Valid:      true,
+	}
+	// Tokens accepted within ClockSkewLeeway of their expiry have no lifetime left to cache them for,
+	// and go-cache would keep an entry with a negative lifetime forever.
+	remainingLifetime := expirationTime.Sub(authService.Clock.Now())
+	if remainingLifetime > 0 {
+		authService.TokenCache.Set(authService.cacheKey(token, url), cacheInfo, remainingLifetime)
+		cachedTokenRemainingLifetime.Observe(remainingLifetime.Seconds())
+	}
+	return reviewResult{cacheInfo: cacheInfo, review: review}, nil
+}
 
-	// Return very basic Principal
-	return NewStaticPrincipal(name, []string{name}), nil
+// shouldRefresh returns true if a cached token expiring at expirationTime is close enough to expiry that it
+// should be proactively reviewed again, and it hasn't already been since coming that close.
+func (authService *KubernetesNativeAuthService) shouldRefresh(expirationTime time.Time, cached CacheData) bool {
+	if authService.CacheRefreshThreshold <= 0 {
+		return false
+	}
+	windowStart := expirationTime.Add(-authService.CacheRefreshThreshold)
+	return authService.Clock.Now().After(windowStart) && !cached.RefreshedAt.After(windowStart)
+}
+
+// refresh synchronously reviews a cached token again. If the review fails for reasons other than the token being
+// rejected, the still-valid cached entry is kept and returned so that a transient failure doesn't fail the request.
+// The returned bool is true if the cached entry was returned rather than a refreshed one.
+// Either way, the entry under key is marked as refreshed, so that the token is refreshed only once before it expires.
+func (authService *KubernetesNativeAuthService) refresh(ctx context.Context, key string, token string, ca string, expirationTime time.Time, cached CacheData) (reviewResult, bool, error) {
+	refreshed, err := authService.coalescedReviewAndCache(ctx, token, ca, expirationTime)
+	if err == nil {
+		authService.markRefreshed(key, refreshed.cacheInfo, expirationTime)
+		return refreshed, false, nil
+	}
+	var rejected *tokenRejectedError
+	if errors.As(err, &rejected) {
+		return reviewResult{}, false, err
+	}
+	log.Warnf("failed to refresh cached kubernetes token for %s, continuing to use cached result: %s", cached.Name, err)
+	authService.markRefreshed(key, cached, expirationTime)
+	return reviewResult{cacheInfo: cached}, true, nil
+}
+
+// markRefreshed replaces the cache entry under key with data, recording that it was refreshed now.
+func (authService *KubernetesNativeAuthService) markRefreshed(key string, data CacheData, expirationTime time.Time) {
+	remainingLifetime := expirationTime.Sub(authService.Clock.Now())
+	if remainingLifetime <= 0 {
+		return
+	}
+	data.RefreshedAt = authService.Clock.Now()
+	authService.TokenCache.Set(key, data, remainingLifetime)
+}
+
+// tokenRejectedError indicates a token was definitively rejected, as opposed to its review failing.
+type tokenRejectedError struct {
+	reason string
+}
+
+func (err *tokenRejectedError) Error() string {
+	return err.reason
+}
+
+// Temporary returns false: a rejected token remains rejected however many times it's retried.
+func (err *tokenRejectedError) Temporary() bool {
+	return false
+}
+
+// malformedTokenError indicates a token couldn't be parsed, or isn't of the expected form.
+type malformedTokenError struct {
+	reason string
+}
+
+func (err *malformedTokenError) Error() string {
+	return err.reason
+}
+
+func (err *malformedTokenError) Temporary() bool {
+	return false
+}
+
+// Prefix of the usernames Kubernetes gives service accounts, which take the form "system:serviceaccount:<ns>:<name>".
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// checkServiceAccountNamespace returns an error if AllowedNamespaces is set and username isn't that of a service
+// account in one of them.
+func (authService *KubernetesNativeAuthService) checkServiceAccountNamespace(username string) error {
+	if len(authService.AllowedNamespaces) == 0 {
+		return nil
+	}
+	if authService.SplitUsernameGroups {
+		username, _ = splitUsernameGroups(username)
+	}
+	namespace, ok := serviceAccountNamespace(username)
+	if !ok {
+		return &tokenRejectedError{fmt.Sprintf("user %s is not a service account", username)}
+	}
+	if !util.ContainsString(authService.AllowedNamespaces, namespace) {
+		return &tokenRejectedError{fmt.Sprintf("service account %s is not in an allowed namespace", username)}
+	}
+	return nil
+}
+
+// serviceAccountNamespace returns the namespace of the service account with the given username.
+// The returned bool is false if username isn't that of a service account.
+func serviceAccountNamespace(username string) (string, bool) {
+	if !strings.HasPrefix(username, serviceAccountUsernamePrefix) {
+		return "", false
+	}
+	namespace, name, found := strings.Cut(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":")
+	if !found || namespace == "" || name == "" || strings.Contains(name, ":") {
+		return "", false
+	}
+	return namespace, true
+}
+
+// principalFromUser builds the Principal for a user returned by TokenReview.
+// Unless ExcludeUsernameFromGroups is set, the username is one of the principal's groups.
+// Groups returned by TokenReview are only used if UseTokenReviewGroups is set; if they aren't, or there are
+// none, DefaultGroups are used instead.
+// If SplitUsernameGroups is set, usernames of the form "user|group1,group2" are split into
+// the name "user" and the additional groups "group1" and "group2".
+// Duplicate groups are removed, keeping the first occurrence of each.
+// If the token has an exp claim, the principal's Deadline is the time it stops being accepted: its expiry plus
+// ClockSkewLeeway. Since tokens are only accepted before then, the deadline of a new principal hasn't passed.
+// See PrincipalDeadline.
+func (authService *KubernetesNativeAuthService) principalFromUser(username string, reviewGroups []string, expiry time.Time) Principal {
+	name, groups := username, []string{}
+	if authService.SplitUsernameGroups {
+		name, groups = splitUsernameGroups(username)
+	}
+	if !authService.UseTokenReviewGroups || len(reviewGroups) == 0 {
+		reviewGroups = authService.DefaultGroups
+	}
+	groups = append(groups, reviewGroups...)
+	if !authService.ExcludeUsernameFromGroups {
+		groups = append([]string{name}, groups...)
+	}
+	principal := NewStaticPrincipal(name, dedupeGroups(groups))
+	if expiry.IsZero() {
+		return principal
+	}
+	return NewExpiringPrincipal(principal, expiry.Add(authService.ClockSkewLeeway))
+}
+
+// dedupeGroups returns groups with duplicates removed, preserving order.
+func dedupeGroups(groups []string) []string {
+	seen := make(map[string]bool, len(groups))
+	deduped := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if !seen[group] {
+			seen[group] = true
+			deduped = append(deduped, group)
+		}
+	}
+	return deduped
+}
+
+func splitUsernameGroups(username string) (string, []string) {
+	name, encodedGroups, found := strings.Cut(username, "|")
+	if !found {
+		return username, []string{}
+	}
+
+	groups := []string{}
+	for _, group := range strings.Split(encodedGroups, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return name, groups
+}
+
+// authHeaderValue returns the credentials stored under the configured metadata key,
+// falling back to the request trailers if no such header was sent.
+// A key may have several values, e.g., if a client sends both OIDC and KubernetesAuth credentials,
+// in which case the first using the KubernetesAuth scheme is returned.
+func (authService *KubernetesNativeAuthService) authHeaderValue(ctx context.Context) string {
+	key := authService.metadataKey()
+	values := metautils.ExtractIncoming(ctx)[key]
+	if len(values) == 0 {
+		values = incomingTrailer(ctx)[key]
+	}
+	for _, value := range values {
+		// Clients sometimes send stray leading or trailing whitespace, e.g., a newline read from a file.
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, kubernetesAuthScheme+" ") {
+			return value
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+func (authService *KubernetesNativeAuthService) metadataKey() string {
+	if authService.MetadataKey == "" {
+		return defaultKubernetesAuthMetadataKey
+	}
+	return strings.ToLower(authService.MetadataKey)
 }
 
 func (authService *KubernetesNativeAuthService) getClusterURL(token string) (string, error) {
-	header := strings.Split(token, ".")[0]
-	decoded, err := base64.RawURLEncoding.DecodeString(header)
+	kid, err := authService.tokenKid(token)
 	if err != nil {
 		return "", err
 	}
+	return authService.clusterURLForKid(kid)
+}
 
-	var unmarshalled struct {
-		Kid string `json:"kid"`
+func (authService *KubernetesNativeAuthService) clusterURLForKid(kid string) (string, error) {
+	var url string
+	if authService.usesDefaultCluster(kid) {
+		url = authService.DefaultClusterURL
+	} else {
+		mappingName, err := authService.mappingName(kid)
+		if err != nil {
+			return "", err
+		}
+		url, err = authService.kidMappingSource().GetClusterURL(mappingName)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := authService.ClusterLimiter.Admit(url); err != nil {
+		return "", err
 	}
+	return url, nil
+}
+
+// usesDefaultCluster returns true if tokens with the given kid are reviewed against DefaultClusterURL,
+// which is only the case for tokens without a kid, when AllowTokensWithoutKid is set.
+func (authService *KubernetesNativeAuthService) usesDefaultCluster(kid string) bool {
+	return kid == "" && authService.AllowTokensWithoutKid && authService.DefaultClusterURL != ""
+}
 
-	if err := json.Unmarshal(decoded, &unmarshalled); err != nil {
+// mappingName returns the name under which the cluster for kid is stored in the kid mapping.
+func (authService *KubernetesNativeAuthService) mappingName(kid string) (string, error) {
+	if err := authService.validateKid(kid); err != nil {
+		return "", err
+	}
+	name, err := authService.stripKidPrefix(kid)
+	if err != nil {
 		return "", err
 	}
+	return authService.clusterPartOfKid(name)
+}
 
-	if err = validateKid(unmarshalled.Kid); err != nil {
+// clusterPartOfKid returns the part of kid before the first KidSeparator, or kid itself if it has none.
+func (authService *KubernetesNativeAuthService) clusterPartOfKid(kid string) (string, error) {
+	if authService.KidSeparator == "" {
+		return kid, nil
+	}
+	cluster, _, found := strings.Cut(kid, authService.KidSeparator)
+	if !found {
+		return kid, nil
+	}
+	if cluster == "" {
+		return "", &malformedTokenError{fmt.Sprintf("composite kid %s has an empty cluster part", kid)}
+	}
+	if err := authService.validateKid(cluster); err != nil {
 		return "", err
 	}
+	return cluster, nil
+}
 
-	url, err := os.ReadFile(authService.KidMappingFileLocation + unmarshalled.Kid)
+// tokenKid returns the kid from the header of a JWT, decoding the header strictly if StrictTokenHeader is set.
+// If AllowedTokenTypes is set, the header's typ is checked too.
+func (authService *KubernetesNativeAuthService) tokenKid(token string) (string, error) {
+	var header tokenHeader
+	var err error
+	if authService.StrictTokenHeader {
+		header, err = parseHeaderStrict(token)
+	} else {
+		header, err = parseHeader(token)
+	}
 	if err != nil {
 		return "", err
 	}
+	if err := authService.checkTokenType(header.Type); err != nil {
+		return "", err
+	}
+	return header.Kid, nil
+}
+
+// checkTokenType returns an error if AllowedTokenTypes is set and doesn't contain typ. Types are compared
+// case-insensitively. Tokens without a typ are accepted, since it's optional and Kubernetes doesn't set it.
+func (authService *KubernetesNativeAuthService) checkTokenType(typ string) error {
+	if len(authService.AllowedTokenTypes) == 0 || typ == "" {
+		return nil
+	}
+	for _, allowed := range authService.AllowedTokenTypes {
+		if strings.EqualFold(typ, allowed) {
+			return nil
+		}
+	}
+	return &tokenRejectedError{fmt.Sprintf("token type %s is not one of the allowed types %v", typ, authService.AllowedTokenTypes)}
+}
 
-	return string(url), nil
+// tokenHeader holds the fields of a JWT header that we make use of.
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Kid       string `json:"kid"`
+	Type      string `json:"typ"`
 }
 
-func (authService *KubernetesNativeAuthService) reviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (string, error) {
-	result, err := authService.TokenReviewer.ReviewToken(ctx, clusterUrl, token, ca)
+// parseKid returns the kid from the header of a JWT.
+func parseKid(token string) (string, error) {
+	header, err := parseHeader(token)
 	if err != nil {
 		return "", err
 	}
+	return header.Kid, nil
+}
+
+// parseHeader returns the header of a JWT, ignoring fields we don't make use of.
+func parseHeader(token string) (tokenHeader, error) {
+	decoded, err := decodeHeader(token)
+	if err != nil {
+		return tokenHeader{}, err
+	}
+
+	var header tokenHeader
+	if err := json.Unmarshal(decoded, &header); err != nil {
+		return tokenHeader{}, &malformedTokenError{fmt.Sprintf("malformed token header: %s", err)}
+	}
+
+	return header, nil
+}
+
+// parseHeaderStrict is like parseHeader, but rejects headers containing fields other than the registered JOSE
+// header parameters.
+func parseHeaderStrict(token string) (tokenHeader, error) {
+	decoded, err := decodeHeader(token)
+	if err != nil {
+		return tokenHeader{}, err
+	}
+
+	var header struct {
+		Algorithm            string          `json:"alg"`
+		JWKSetURL            string          `json:"jku"`
+		JSONWebKey           json.RawMessage `json:"jwk"`
+		Kid                  string          `json:"kid"`
+		X509URL              string          `json:"x5u"`
+		X509CertificateChain []string        `json:"x5c"`
+		X509Thumbprint       string          `json:"x5t"`
+		X509ThumbprintSHA256 string          `json:"x5t#S256"`
+		Type                 string          `json:"typ"`
+		ContentType          string          `json:"cty"`
+		Critical             []string        `json:"crit"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&header); err != nil {
+		return tokenHeader{}, &malformedTokenError{fmt.Sprintf("malformed token header: %s", err)}
+	}
+	if decoder.More() {
+		return tokenHeader{}, &malformedTokenError{"malformed token header: unexpected data after header"}
+	}
+
+	return tokenHeader{Algorithm: header.Algorithm, Kid: header.Kid, Type: header.Type}, nil
+}
+
+// decodeHeader returns the decoded header of a JWT, checking it's valid JSON.
+func decodeHeader(token string) ([]byte, error) {
+	header := strings.Split(token, ".")[0]
+	decoded, err := decodeSegment(header)
+	if err != nil {
+		return nil, &malformedTokenError{fmt.Sprintf("malformed token header: %s", err)}
+	}
+	if !json.Valid(decoded) {
+		return nil, &malformedTokenError{"malformed token header: not valid JSON"}
+	}
+	return decoded, nil
+}
+
+// kidMappingSource returns the configured KidMappingSource,
+// defaulting to reading one file per kid from KidMappingFileLocation.
+func (authService *KubernetesNativeAuthService) kidMappingSource() KidMappingSource {
+	if authService.KidMappingSource != nil {
+		return authService.KidMappingSource
+	}
+	return defaultKidMappingSource(authService.KidMappingFileLocation, authService.Clock)
+}
+
+// stripKidPrefix removes KidPrefix from kid, returning an error if kid doesn't start with it.
+func (authService *KubernetesNativeAuthService) stripKidPrefix(kid string) (string, error) {
+	if authService.KidPrefix == "" {
+		return kid, nil
+	}
+	stripped := strings.TrimPrefix(kid, authService.KidPrefix)
+	if stripped == kid {
+		return "", &tokenRejectedError{fmt.Sprintf("kid %s does not start with expected prefix %s", kid, authService.KidPrefix)}
+	}
+	if err := authService.validateKid(stripped); err != nil {
+		return "", err
+	}
+	return stripped, nil
+}
+
+// reviewToken reviews token, returning the authenticated TokenReview with its Spec.Token cleared.
+// If audiences is non-empty, TokenReview must confirm the token is valid for at least one of them.
+func (authService *KubernetesNativeAuthService) reviewToken(ctx context.Context, clusterUrl string, token string, ca []byte, audiences []string) (*authv1.TokenReview, error) {
+	if err := validateCA(ca); err != nil {
+		return nil, err
+	}
+	if len(audiences) > 0 {
+		ctx = WithTokenReviewAudiences(ctx, audiences)
+	}
+	ctx, done, err := authService.shutdown.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := authService.TokenReviewer.ReviewToken(ctx, clusterUrl, token, ca)
+	done()
+	if isTokenRejection(err) {
+		authService.cacheRejection(token, clusterUrl)
+		return nil, &tokenRejectedError{fmt.Sprintf("provided token was refused by the TokenReview API: %s", RedactToken(err, token))}
+	}
+	if err != nil {
+		return nil, RedactToken(err, token)
+	}
 
 	if !result.Status.Authenticated {
-		authService.TokenCache.Set(token, CacheData{Valid: false}, time.Duration(authService.InvalidTokenExpiry))
-		return "", fmt.Errorf("provided token was rejected by TokenReview")
+		authService.cacheRejection(token, clusterUrl)
+		return nil, &tokenRejectedError{"provided token was rejected by TokenReview"}
+	}
+
+	// Guard against API servers that ignore the requested audiences.
+	if len(audiences) > 0 && !containsAny(result.Status.Audiences, audiences) {
+		authService.cacheRejection(token, clusterUrl)
+		return nil, &tokenRejectedError{fmt.Sprintf(
+			"TokenReview validated audiences %v, none of which are expected audiences %v", result.Status.Audiences, audiences)}
+	}
+
+	review := result.DeepCopy()
+	review.Spec.Token = ""
+	return review, nil
+}
+
+// CacheTTL returns how much longer the result of authenticating token remains cached, whether it was accepted
+// or rejected. The returned bool is false if token isn't cached.
+func (authService *KubernetesNativeAuthService) CacheTTL(token string) (time.Duration, bool) {
+	key, err := authService.lookupCacheKey(token)
+	if err != nil {
+		return 0, false
+	}
+	_, expiration, found := authService.TokenCache.GetWithExpiration(key)
+	if !found {
+		return 0, false
+	}
+	if expiration.IsZero() {
+		// The entry never expires.
+		return time.Duration(math.MaxInt64), true
+	}
+	// go-cache computes expiry times using the real clock, so Clock isn't used here.
+	return time.Until(expiration), true
+}
+
+// tokenCacheKey returns the key under which the result of authenticating token is cached.
+// Tokens are keyed by their SHA-256 fingerprint, so that the cache doesn't hold on to bearer tokens.
+func (authService *KubernetesNativeAuthService) tokenCacheKey(token string) string {
+	fingerprint := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// Separates the token fingerprint from the cluster URL in cache keys if CacheByCluster is set.
+const clusterCacheKeySeparator = "@"
+
+// cacheKey returns the key under which the result of reviewing token against clusterUrl is cached.
+// Unless CacheByCluster is set, this is the same for every cluster.
+func (authService *KubernetesNativeAuthService) cacheKey(token string, clusterUrl string) string {
+	if !authService.CacheByCluster {
+		return authService.tokenCacheKey(token)
+	}
+	return authService.tokenCacheKey(token) + clusterCacheKeySeparator + canonicalClusterCacheURL(clusterUrl)
+}
+
+// lookupCacheKey returns the key under which the result of authenticating token would be cached. If
+// CacheByCluster is set, this requires resolving the cluster of the token's kid.
+func (authService *KubernetesNativeAuthService) lookupCacheKey(token string) (string, error) {
+	if !authService.CacheByCluster {
+		return authService.tokenCacheKey(token), nil
+	}
+	url, err := authService.getClusterURL(token)
+	if err != nil {
+		return "", err
+	}
+	return authService.cacheKey(token, url), nil
+}
+
+// canonicalClusterCacheURL returns the canonical form of clusterUrl, or clusterUrl itself if it can't be parsed.
+func canonicalClusterCacheURL(clusterUrl string) string {
+	canonical, err := canonicalizeClusterURL(clusterUrl)
+	if err != nil {
+		return clusterUrl
+	}
+	return canonical
+}
+
+// SetInvalidTokenExpiry changes how long tokens rejected from now on are cached for.
+// Zero or negative disables caching of rejected tokens.
+// It's safe to call while requests are being authenticated.
+func (authService *KubernetesNativeAuthService) SetInvalidTokenExpiry(expiry time.Duration) {
+	atomic.StoreInt64(&authService.InvalidTokenExpiry, int64(expiry))
+}
+
+func (authService *KubernetesNativeAuthService) invalidTokenExpiry() time.Duration {
+	return time.Duration(atomic.LoadInt64(&authService.InvalidTokenExpiry))
+}
+
+// cacheRejection caches that token was rejected by the cluster at clusterUrl, for InvalidTokenExpiry.
+// Nothing is cached if InvalidTokenExpiry isn't positive: go-cache would otherwise treat zero as its
+// default expiration and negative values as never expiring.
+func (authService *KubernetesNativeAuthService) cacheRejection(token string, clusterUrl string) {
+	expiry := authService.invalidTokenExpiry()
+	if expiry <= 0 {
+		return
+	}
+	authService.TokenCache.Set(authService.cacheKey(token, clusterUrl), CacheData{Valid: false}, expiry)
+}
+
+// RedactToken returns an error whose message is that of err with every occurrence of token replaced by "[REDACTED]",
+// since errors from the Kubernetes client may embed the bearer token in a URL or message.
+// The returned error wraps err, so errors.Is and errors.As continue to work; note that the messages of
+// errors obtained by unwrapping it are not redacted.
+func RedactToken(err error, token string) error {
+	if err == nil || token == "" || !strings.Contains(err.Error(), token) {
+		return err
+	}
+	return &redactedError{
+		message: strings.ReplaceAll(err.Error(), token, "[REDACTED]"),
+		err:     err,
+	}
+}
+
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (err *redactedError) Error() string {
+	return err.message
+}
+
+func (err *redactedError) Unwrap() error {
+	return err.err
+}
+
+func containsAny(values []string, wanted []string) bool {
+	for _, value := range wanted {
+		if util.ContainsString(values, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeKubernetesAuthHeader encodes token and ca into the credentials expected by KubernetesNativeAuthService,
+// i.e., the unpadded base64url encoding of the JSON object {"token": token, "ca": ca}, with ca itself encoded
+// as unpadded base64url. Clients send these in the authorization header, prefixed by "KubernetesAuth ".
+func EncodeKubernetesAuthHeader(token string, ca []byte) string {
+	body, err := json.Marshal(struct {
+		Token string `json:"token"`
+		Ca    string `json:"ca"`
+	}{
+		Token: token,
+		Ca:    base64.RawURLEncoding.EncodeToString(ca),
+	})
+	if err != nil {
+		// Marshalling a struct of strings can't fail.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+// DecodeKubernetesAuthHeader decodes the value of a KubernetesAuth authorization header, returning the token
+// and CA it contains, for tooling wishing to inspect headers. The "KubernetesAuth " scheme prefix is optional.
+// The token is checked to be of the form of a JWT, but isn't otherwise validated.
+func DecodeKubernetesAuthHeader(value string) (token string, ca string, err error) {
+	credentials := strings.TrimSpace(value)
+	if scheme, rest, found := strings.Cut(credentials, " "); found {
+		if scheme != kubernetesAuthScheme {
+			return "", "", fmt.Errorf("unexpected authorization scheme %s, expected %s", scheme, kubernetesAuthScheme)
+		}
+		credentials = strings.TrimSpace(rest)
+	}
+	token, ca, err = parseAuth(credentials)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode KubernetesAuth credentials: %s", err)
+	}
+	if token == "" {
+		return "", "", fmt.Errorf("KubernetesAuth credentials contain no token")
 	}
+	if err := checkPlausibleJWT(token); err != nil {
+		return "", "", err
+	}
+	return token, ca, nil
+}
 
-	return result.Status.User.Username, nil
+// Minimum length of encoded KubernetesAuth credentials. Anything shorter can't hold a token, so isn't decoded.
+const minKubernetesAuthCredentialsLength = 32
+
+// Minimum length of a JWT. Even a token with empty header and payload objects is longer.
+const minJWTLength = 10
+
+// checkPlausibleJWT returns an error unless token could be a JWT, i.e., it's three dot-separated segments,
+// of which the header and payload are non-empty. It's intended to reject obviously malformed tokens before any
+// work is done on them.
+func checkPlausibleJWT(token string) error {
+	if len(token) < minJWTLength {
+		return &malformedTokenError{"provided JWT token is too short"}
+	}
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return &malformedTokenError{"provided JWT token was not of the correct form, should have 3 parts"}
+	}
+	if segments[0] == "" || segments[1] == "" {
+		return &malformedTokenError{"provided JWT token was not of the correct form, has an empty header or payload"}
+	}
+	return nil
 }
 
 func parseAuth(auth string) (string, string, error) {
+	if len(auth) < minKubernetesAuthCredentialsLength {
+		return "", "", fmt.Errorf("KubernetesAuth credentials are too short")
+	}
 	jsonData, err := base64.RawURLEncoding.DecodeString(auth)
 	if err != nil {
 		return "", "", err
@@ -192,42 +1346,174 @@ func parseAuth(auth string) (string, string, error) {
 		return "", "", err
 	}
 
+	ca, err = decompressCA(ca)
+	if err != nil {
+		return "", "", err
+	}
+
 	return uMbody.Token, string(ca), nil
 }
 
-func parseTime(token string) (time.Time, error) {
-	splitToken := strings.Split(token, ".")
-	if len(splitToken) != 3 {
-		return time.Time{}, fmt.Errorf("provided JWT token was not of the correct form, should have 3 parts")
+// validateCA checks ca is a PEM bundle containing at least one parseable certificate, so that a malformed CA is
+// reported clearly rather than as an opaque TLS error from the Kubernetes client. An empty CA is valid, in which
+// case the system roots are used.
+func validateCA(ca []byte) error {
+	if len(bytes.TrimSpace(ca)) == 0 {
+		return nil
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		return &malformedTokenError{"invalid CA bundle: no PEM-encoded certificates could be parsed"}
+	}
+	return nil
+}
+
+// gzipMagic is the two-byte header that starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Maximum size of a decompressed CA bundle. Far larger than any real bundle, but small enough that a client
+// can't exhaust memory by sending a highly compressible one.
+const maxDecompressedCASize = 1 << 20
+
+// decompressCA transparently gunzips the CA bundle if the client compressed it before encoding.
+// A PEM bundle can never start with the gzip magic bytes, so plain CAs are returned unchanged.
+// Bundles decompressing to more than maxDecompressedCASize bytes are rejected.
+func decompressCA(ca []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ca, gzipMagic) {
+		return ca, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(ca))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzipped CA: %s", err)
 	}
+	defer reader.Close()
 
-	decoded, err := base64.RawURLEncoding.DecodeString(splitToken[1])
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecompressedCASize+1))
 	if err != nil {
-		return time.Time{}, err
+		return nil, fmt.Errorf("failed to decompress gzipped CA: %s", err)
+	}
+	if len(decompressed) > maxDecompressedCASize {
+		return nil, fmt.Errorf("failed to decompress gzipped CA: larger than %d bytes", maxDecompressedCASize)
+	}
+	return decompressed, nil
+}
+
+// tokenClaims holds the claims decoded from a JWT payload that we make use of.
+// Expiry and IssuedAt are the zero time if the token has no exp or iat claim respectively.
+type tokenClaims struct {
+	TemporalClaims
+	Subject string
+}
+
+// TemporalClaims are the time-based claims of a token. Each is zero if the token doesn't set it.
+type TemporalClaims struct {
+	NotBefore time.Time
+	IssuedAt  time.Time
+	Expiry    time.Time
+}
+
+// decodeSegment decodes a JWT segment. Segments should be unpadded base64url,
+// but some non-conformant issuers use standard base64, so padded and
+// standard forms are accepted as well.
+func decodeSegment(segment string) ([]byte, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err == nil {
+		return decoded, nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.URLEncoding, base64.StdEncoding, base64.RawStdEncoding} {
+		if decoded, otherErr := encoding.DecodeString(segment); otherErr == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+func parseClaims(token string) (tokenClaims, error) {
+	if err := checkPlausibleJWT(token); err != nil {
+		return tokenClaims{}, err
+	}
+	splitToken := strings.Split(token, ".")
+
+	decoded, err := decodeSegment(splitToken[1])
+	if err != nil {
+		return tokenClaims{}, err
 	}
 	var uMbody struct {
-		Expiry int64 `json:"exp"`
+		Expiry    int64  `json:"exp"`
+		IssuedAt  int64  `json:"iat"`
+		NotBefore int64  `json:"nbf"`
+		Subject   string `json:"sub"`
 	}
 
 	if err := json.Unmarshal(decoded, &uMbody); err != nil {
-		return time.Time{}, err
+		return tokenClaims{}, err
 	}
 
-	if uMbody.Expiry == 0 {
-		return time.Time{}, fmt.Errorf("token expiry time not set")
+	claims := tokenClaims{Subject: uMbody.Subject}
+	if uMbody.Expiry != 0 {
+		claims.Expiry = time.Unix(uMbody.Expiry, 0)
 	}
+	if uMbody.IssuedAt != 0 {
+		claims.IssuedAt = time.Unix(uMbody.IssuedAt, 0)
+	}
+	if uMbody.NotBefore != 0 {
+		claims.NotBefore = time.Unix(uMbody.NotBefore, 0)
+	}
+	return claims, nil
+}
 
-	time := time.Unix(uMbody.Expiry, 0)
-	return time, nil
+// expirationTime returns the time until which a token may be considered valid.
+// Tokens without an exp claim are rejected unless AllowNonExpiringTokens is set,
+// in which case they're considered valid for NonExpiringTokenCacheTTL from now.
+func (authService *KubernetesNativeAuthService) expirationTime(claims tokenClaims) (time.Time, error) {
+	if !claims.Expiry.IsZero() {
+		return claims.Expiry, nil
+	}
+	if !authService.AllowNonExpiringTokens {
+		return time.Time{}, errTokenExpiryNotSet
+	}
+	ttl := authService.NonExpiringTokenCacheTTL
+	if ttl <= 0 {
+		ttl = defaultNonExpiringTokenCacheTTL
+	}
+	return authService.Clock.Now().Add(ttl), nil
+}
+
+// ValidateTemporalClaims checks the time-based claims of a token at time now, returning errTokenNotYetValid if
+// nbf is later than now+leeway, errTokenIssuedInFuture if iat is later than now+maxIssuedAtSkew, and
+// errTokenExpired unless exp is later than now-leeway. Claims that aren't set aren't checked, nor is iat
+// if maxIssuedAtSkew is zero.
+func ValidateTemporalClaims(claims TemporalClaims, now time.Time, leeway time.Duration, maxIssuedAtSkew time.Duration) error {
+	if !claims.NotBefore.IsZero() && claims.NotBefore.After(now.Add(leeway)) {
+		return errTokenNotYetValid
+	}
+	if maxIssuedAtSkew > 0 && !claims.IssuedAt.IsZero() && claims.IssuedAt.After(now.Add(maxIssuedAtSkew)) {
+		return errTokenIssuedInFuture
+	}
+	if !claims.Expiry.IsZero() && !claims.Expiry.After(now.Add(-leeway)) {
+		return errTokenExpired
+	}
+	return nil
+}
+
+// validateKid checks kid using KidValidator if set, or validateKid otherwise.
+func (authService *KubernetesNativeAuthService) validateKid(kid string) error {
+	if authService.KidValidator == nil {
+		return validateKid(kid)
+	}
+	if err := authService.KidValidator(kid); err != nil {
+		return &tokenRejectedError{fmt.Sprintf("kid %s rejected: %s", kid, err)}
+	}
+	return nil
 }
 
 func validateKid(kid string) error {
 	if kid == "" {
-		return fmt.Errorf("kubernetes serviceaccount token KID must not be empty")
+		return &malformedTokenError{"kubernetes serviceaccount token KID must not be empty"}
 	}
 
 	if strings.Contains(kid, "../") {
-		return fmt.Errorf("kid appears to contain ../, this appears to be an attack")
+		return &malformedTokenError{"kid appears to contain ../, this appears to be an attack"}
 	}
 
 	return nil
@@ -0,0 +1,91 @@
+package authorization
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Window over which kid activity is reported by KubernetesNativeAuthService.ActiveKids.
+const kidActivityWindow = 15 * time.Minute
+
+// ActiveKid summarises recent authentications made with tokens carrying a particular kid.
+type ActiveKid struct {
+	Kid        string
+	ClusterURL string
+	// Number of authentications with this kid since it was last inactive for a full window.
+	Count    int
+	LastSeen time.Time
+}
+
+// KidActivityTracker counts authentications per kid, forgetting kids not seen within Window.
+// All methods are safe to call on a nil tracker, which tracks nothing.
+type KidActivityTracker struct {
+	Window time.Duration
+	Clock  clock.Clock
+
+	mutex sync.Mutex
+	kids  map[string]*ActiveKid
+}
+
+func NewKidActivityTracker(window time.Duration, clock clock.Clock) *KidActivityTracker {
+	return &KidActivityTracker{
+		Window: window,
+		Clock:  clock,
+		kids:   map[string]*ActiveKid{},
+	}
+}
+
+// Record notes an authentication with a token carrying kid, resolved to clusterUrl.
+func (tracker *KidActivityTracker) Record(kid string, clusterUrl string) {
+	if tracker == nil {
+		return
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := tracker.Clock.Now()
+	tracker.prune(now)
+	entry, ok := tracker.kids[kid]
+	if !ok {
+		entry = &ActiveKid{Kid: kid}
+		tracker.kids[kid] = entry
+	}
+	entry.ClusterURL = clusterUrl
+	entry.Count++
+	entry.LastSeen = now
+}
+
+// Active returns the kids seen within the window, sorted by kid.
+func (tracker *KidActivityTracker) Active() []ActiveKid {
+	if tracker == nil {
+		return []ActiveKid{}
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.prune(tracker.Clock.Now())
+	active := make([]ActiveKid, 0, len(tracker.kids))
+	for _, entry := range tracker.kids {
+		active = append(active, *entry)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Kid < active[j].Kid
+	})
+	return active
+}
+
+func (tracker *KidActivityTracker) prune(now time.Time) {
+	for kid, entry := range tracker.kids {
+		if now.Sub(entry.LastSeen) > tracker.Window {
+			delete(tracker.kids, kid)
+		}
+	}
+}
+
+// ActiveKids returns the kids, and the cluster URLs they resolve to, recently used to authenticate.
+func (authService *KubernetesNativeAuthService) ActiveKids() []ActiveKid {
+	return authService.KidActivity.Active()
+}
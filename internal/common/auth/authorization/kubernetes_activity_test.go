@@ -0,0 +1,40 @@
+package authorization
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestActiveKids(t *testing.T) {
+	const otherKid = "other-kid"
+	const otherUrl = "https://other.config.test:420"
+	kidMappingDir := createKidMappingDir(t)
+	assert.NoError(t, os.WriteFile(filepath.Join(kidMappingDir, otherKid), []byte(otherUrl), 0o644))
+
+	authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+	fakeClock := authService.Clock.(*clock.FakeClock)
+	authService.KidActivity = NewKidActivityTracker(time.Minute, fakeClock)
+	otherToken := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, otherKid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+
+	// The second authentication with testToken is served from the cache, but still counts as activity.
+	for _, token := range []string{testToken, testToken, otherToken} {
+		_, err := authService.Authenticate(createAuthContext(token))
+		assert.NoError(t, err)
+	}
+
+	now := fakeClock.Now()
+	assert.Equal(t, []ActiveKid{
+		{Kid: testKid, ClusterURL: testUrl, Count: 2, LastSeen: now},
+		{Kid: otherKid, ClusterURL: otherUrl, Count: 1, LastSeen: now},
+	}, authService.ActiveKids())
+
+	// Kids drop out once they haven't been seen for a full window.
+	fakeClock.Step(2 * time.Minute)
+	assert.Empty(t, authService.ActiveKids())
+}
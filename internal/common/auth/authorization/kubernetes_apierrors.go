@@ -0,0 +1,41 @@
+package authorization
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// isTokenRejection returns true if err is a response from the API server refusing a TokenReview with a 4xx status
+// other than 429. TokenReviews are authenticated with the token under review, so such responses, 401 and 403 in
+// particular, mean the token itself is invalid or revoked rather than that the cluster is unavailable.
+func isTokenRejection(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	code := status.Status().Code
+	return code >= 400 && code < 500 && code != http.StatusTooManyRequests
+}
+
+// isInfrastructureFailure returns true if err, returned by a review made with ctx, means a cluster couldn't review a
+// token because of a problem that may be transient: a 5xx or 429 response, a timeout, or a failure to reach the API
+// server. Rejections, errors caused by the caller's context ending, and failures to verify the API server's
+// certificate, which may be caused by a bad client-supplied CA, are not.
+func isInfrastructureFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		code := status.Status().Code
+		return code >= 500 || code == http.StatusTooManyRequests
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCertificate x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return !errors.As(err, &unknownAuthority) && !errors.As(err, &invalidCertificate) && !errors.As(err, &hostname)
+}
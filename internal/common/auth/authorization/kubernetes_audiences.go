@@ -0,0 +1,47 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Suffix appended to a kid's mapping file name to get the name of the file overriding its audiences.
+const kidAudiencesFileSuffix = ".audiences"
+
+// audiencesForKid returns the audiences tokens with the given kid are reviewed against. If PerKidAudiences is set
+// and the kid has an audiences file, the audiences listed in it are returned. Otherwise, including for tokens
+// without a kid, Audiences is returned.
+func (authService *KubernetesNativeAuthService) audiencesForKid(kid string) ([]string, error) {
+	if !authService.PerKidAudiences || authService.usesDefaultCluster(kid) {
+		return authService.Audiences, nil
+	}
+	name, err := authService.mappingName(kid)
+	if err != nil {
+		return nil, err
+	}
+	path := authService.KidMappingFileLocation + name + kidAudiencesFileSuffix
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return authService.Audiences, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audiences for kid %s: %s", kid, err)
+	}
+	return parseAudiences(string(contents)), nil
+}
+
+// parseAudiences returns the audiences listed one per line in contents, ignoring blank lines and lines starting with #.
+func parseAudiences(contents string) []string {
+	audiences := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		audiences = append(audiences, line)
+	}
+	return audiences
+}
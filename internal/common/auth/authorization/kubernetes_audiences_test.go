@@ -0,0 +1,71 @@
+package authorization
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate_PerKidAudiences(t *testing.T) {
+	tests := map[string]struct {
+		audiencesFile      string
+		validatedAudiences []string
+		expectedAudiences  []string
+		expectError        bool
+	}{
+		"per-kid override": {
+			audiencesFile:      "# audiences for cluster a\ncluster-a\n\narmada-a\n",
+			validatedAudiences: []string{"armada-a"},
+			expectedAudiences:  []string{"cluster-a", "armada-a"},
+		},
+		"per-kid override rejects global audience": {
+			audiencesFile:      "cluster-a\n",
+			validatedAudiences: []string{"armada"},
+			expectedAudiences:  []string{"cluster-a"},
+			expectError:        true,
+		},
+		"global fallback": {
+			validatedAudiences: []string{"armada"},
+			expectedAudiences:  []string{"armada"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kidMappingDir := createKidMappingDir(t)
+			if tc.audiencesFile != "" {
+				err := os.WriteFile(filepath.Join(kidMappingDir, testKid+kidAudiencesFileSuffix), []byte(tc.audiencesFile), 0o644)
+				assert.NoError(t, err)
+			}
+			reviewer := &AudienceTokenReviewer{ValidatedAudiences: tc.validatedAudiences}
+			authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+			authService.TokenReviewer = reviewer
+			authService.Audiences = []string{"armada"}
+			authService.PerKidAudiences = true
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.Equal(t, tc.expectedAudiences, reviewer.RequestedAudiences)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testName, principal.GetName())
+			}
+		})
+	}
+}
+
+func TestAuthenticate_PerKidAudiencesDisabled(t *testing.T) {
+	kidMappingDir := createKidMappingDir(t)
+	err := os.WriteFile(filepath.Join(kidMappingDir, testKid+kidAudiencesFileSuffix), []byte("cluster-a\n"), 0o644)
+	assert.NoError(t, err)
+	reviewer := &AudienceTokenReviewer{ValidatedAudiences: []string{"armada"}}
+	authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+	authService.TokenReviewer = reviewer
+	authService.Audiences = []string{"armada"}
+
+	_, err = authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"armada"}, reviewer.RequestedAudiences)
+}
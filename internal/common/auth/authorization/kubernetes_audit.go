@@ -0,0 +1,76 @@
+package authorization
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// Outcomes of authentication decisions reported to an AuditSink.
+const (
+	AuthOutcomeAccepted = "accepted"
+	AuthOutcomeRejected = "rejected"
+)
+
+// AuthEvent describes a single authentication decision. It never contains the token itself.
+type AuthEvent struct {
+	Time time.Time
+	// AuthOutcomeAccepted or AuthOutcomeRejected.
+	Outcome string
+	// Name of the authenticated principal. Empty if the request was rejected.
+	Principal string
+	// Kid of the token, if it could be parsed.
+	Kid string
+	// URL of the cluster that issued the token. Empty if the request was rejected.
+	ClusterURL string
+	// Address of the client that made the request, if known.
+	Peer string
+	// Why the request was rejected. Empty if it was accepted.
+	Reason string
+	// True if the decision was based on a cached result.
+	FromCache bool
+}
+
+// AuditSink receives an event for every authentication decision made by a KubernetesNativeAuthService,
+// providing an audit trail independent of logging. Requests without KubernetesAuth credentials aren't
+// reported, since they're left for other auth services to authenticate.
+// RecordAuth is called synchronously while authenticating, so shouldn't block.
+type AuditSink interface {
+	RecordAuth(event AuthEvent)
+}
+
+// audit reports the result of authenticating the credentials in ctx, holding token, to AuditSink, if set.
+// token is empty if the credentials couldn't be parsed.
+func (authService *KubernetesNativeAuthService) audit(ctx context.Context, principal Principal, info TokenInfo, token string, err error) {
+	if authService.AuditSink == nil || err == missingCredentials {
+		return
+	}
+	event := AuthEvent{
+		Time:       authService.Clock.Now(),
+		Kid:        info.Kid,
+		ClusterURL: info.ClusterURL,
+		FromCache:  info.FromCache,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event.Peer = p.Addr.String()
+	}
+	if err != nil {
+		event.Outcome = AuthOutcomeRejected
+		event.Reason = RedactToken(err, token).Error()
+		event.Kid = kidForReporting(token)
+	} else {
+		event.Outcome = AuthOutcomeAccepted
+		event.Principal = principal.GetName()
+	}
+	authService.AuditSink.RecordAuth(event)
+}
+
+// kidForReporting returns the kid of token, or the empty string if it can't be parsed.
+func kidForReporting(token string) string {
+	kid, err := parseKid(token)
+	if err != nil {
+		return ""
+	}
+	return kid
+}
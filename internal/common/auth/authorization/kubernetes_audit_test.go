@@ -0,0 +1,72 @@
+package authorization
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/peer"
+)
+
+type recordingAuditSink struct {
+	events []AuthEvent
+}
+
+func (sink *recordingAuditSink) RecordAuth(event AuthEvent) {
+	sink.events = append(sink.events, event)
+}
+
+func TestAuthenticate_AuditsEveryDecision(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.SetInvalidTokenExpiry(time.Minute)
+	sink := &recordingAuditSink{}
+	authService.AuditSink = sink
+	ctx := peer.NewContext(createAuthContext(testToken), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+
+	// Reviewed, then served from the cache.
+	for i := 0; i < 2; i++ {
+		_, err := authService.Authenticate(ctx)
+		assert.NoError(t, err)
+	}
+	if assert.Len(t, sink.events, 2) {
+		for i, event := range sink.events {
+			assert.Equal(t, AuthOutcomeAccepted, event.Outcome)
+			assert.Equal(t, testName, event.Principal)
+			assert.Equal(t, testKid, event.Kid)
+			assert.Equal(t, testUrl, event.ClusterURL)
+			assert.Equal(t, "10.0.0.1:1234", event.Peer)
+			assert.Equal(t, time.Unix(testTokenIss, 0), event.Time)
+			assert.Empty(t, event.Reason)
+			assert.Equal(t, i == 1, event.FromCache)
+		}
+	}
+
+	// Rejected once the token has expired.
+	authService.Clock = createTestAuthService("", true, testName, testTokenExp+1).Clock
+	_, err := authService.Authenticate(ctx)
+	assert.Error(t, err)
+	if assert.Len(t, sink.events, 3) {
+		event := sink.events[2]
+		assert.Equal(t, AuthOutcomeRejected, event.Outcome)
+		assert.Empty(t, event.Principal)
+		assert.Equal(t, testKid, event.Kid)
+		assert.NotEmpty(t, event.Reason)
+	}
+
+	for _, event := range sink.events {
+		assert.NotContains(t, event.Reason, testToken)
+		assert.False(t, strings.Contains(event.Peer+event.Kid+event.ClusterURL+event.Principal, testToken))
+	}
+}
+
+func TestAuthenticate_DoesNotAuditMissingCredentials(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	sink := &recordingAuditSink{}
+	authService.AuditSink = sink
+
+	_, err := authService.Authenticate(peer.NewContext(createAuthContextWithKey("other", testToken), &peer.Peer{}))
+	assert.ErrorIs(t, err, missingCredentials)
+	assert.Empty(t, sink.events)
+}
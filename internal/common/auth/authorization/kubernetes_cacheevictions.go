@@ -0,0 +1,100 @@
+package authorization
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CacheEvictionReason describes why an entry left the token cache.
+type CacheEvictionReason string
+
+const (
+	// The entry's TTL elapsed and it was removed by the cache's janitor.
+	CacheEvictionExpired CacheEvictionReason = "expired"
+	// The entry was explicitly removed with InvalidateToken or InvalidateCluster.
+	CacheEvictionInvalidated CacheEvictionReason = "invalidated"
+)
+
+// CacheEvictionObserver is notified by the token cache whenever an entry is evicted. It records a metric for
+// every eviction and forwards the eviction to Sink, if set.
+type CacheEvictionObserver struct {
+	// Optional callback invoked for every eviction. Must be set before the auth service is used.
+	Sink func(reason CacheEvictionReason, data CacheData)
+	// Cache keys of tokens currently being invalidated, used to tell invalidations apart from expiries.
+	invalidating sync.Map
+}
+
+func (observer *CacheEvictionObserver) onEvicted(key string, value interface{}) {
+	reason := CacheEvictionExpired
+	if _, ok := observer.invalidating.Load(key); ok {
+		reason = CacheEvictionInvalidated
+	}
+	data, _ := value.(CacheData)
+	tokenCacheEvictionsTotal.WithLabelValues(string(reason), strconv.FormatBool(data.Valid)).Inc()
+	if observer.Sink != nil {
+		observer.Sink(reason, data)
+	}
+}
+
+// InvalidateToken removes token from the cache, so that it's reviewed again next time it's used.
+// If CacheByCluster is set, the token is removed for every cluster.
+func (authService *KubernetesNativeAuthService) InvalidateToken(token string) {
+	key := authService.tokenCacheKey(token)
+	if !authService.CacheByCluster {
+		authService.invalidate(key)
+		return
+	}
+	prefix := key + clusterCacheKeySeparator
+	authService.invalidateMatching(func(key string, _ CacheData) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// InvalidateCluster removes every cached token reviewed against clusterUrl, returning the number removed.
+// If CacheByCluster is set, rejected tokens are removed too; otherwise only accepted tokens record their
+// cluster, so rejected ones remain cached until they expire.
+func (authService *KubernetesNativeAuthService) InvalidateCluster(clusterUrl string) int {
+	canonical := canonicalClusterCacheURL(clusterUrl)
+	if authService.CacheByCluster {
+		suffix := clusterCacheKeySeparator + canonical
+		return authService.invalidateMatching(func(key string, _ CacheData) bool {
+			return strings.HasSuffix(key, suffix)
+		})
+	}
+	return authService.invalidateMatching(func(_ string, data CacheData) bool {
+		return data.ClusterURL != "" && canonicalClusterCacheURL(data.ClusterURL) == canonical
+	})
+}
+
+// InvalidateWhere removes every cached token whose CacheData matches, e.g. every token of a given user,
+// returning the number removed. It's safe to call while requests are being authenticated, though tokens
+// cached during the call may or may not be removed.
+// Entries of an unexpected type are matched as if their CacheData were empty.
+func (authService *KubernetesNativeAuthService) InvalidateWhere(match func(data CacheData) bool) int {
+	return authService.invalidateMatching(func(_ string, data CacheData) bool { return match(data) })
+}
+
+// invalidateMatching removes every cache entry for which match returns true, returning the number removed.
+func (authService *KubernetesNativeAuthService) invalidateMatching(match func(key string, data CacheData) bool) int {
+	removed := 0
+	for key, item := range authService.TokenCache.Items() {
+		data, _ := item.Object.(CacheData)
+		if match(key, data) {
+			authService.invalidate(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// invalidate removes the entry with the given key from the cache, reporting its eviction as an invalidation.
+func (authService *KubernetesNativeAuthService) invalidate(key string) {
+	if authService.CacheEvictions == nil {
+		authService.TokenCache.Delete(key)
+		return
+	}
+	authService.CacheEvictions.invalidating.Store(key, struct{}{})
+	defer authService.CacheEvictions.invalidating.Delete(key)
+	authService.TokenCache.Delete(key)
+}
@@ -0,0 +1,151 @@
+package authorization
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+
+	"github.com/G-Research/armada/internal/common/auth/configuration"
+)
+
+type recordedEviction struct {
+	reason CacheEvictionReason
+	data   CacheData
+}
+
+func TestCacheEvictions_Expired(t *testing.T) {
+	authService := NewKubernetesNativeAuthService(configuration.KubernetesAuthConfig{})
+	var evictions []recordedEviction
+	authService.CacheEvictions.Sink = func(reason CacheEvictionReason, data CacheData) {
+		evictions = append(evictions, recordedEviction{reason: reason, data: data})
+	}
+	expiredBefore := testutil.ToFloat64(tokenCacheEvictionsTotal.WithLabelValues(string(CacheEvictionExpired), "false"))
+
+	authService.TokenCache.Set(authService.tokenCacheKey(testToken), CacheData{Valid: false}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	authService.TokenCache.DeleteExpired()
+
+	assert.Equal(t, []recordedEviction{{reason: CacheEvictionExpired, data: CacheData{Valid: false}}}, evictions)
+	assert.Equal(t, expiredBefore+1, testutil.ToFloat64(tokenCacheEvictionsTotal.WithLabelValues(string(CacheEvictionExpired), "false")))
+}
+
+func TestCacheEvictions_Invalidated(t *testing.T) {
+	authService := NewKubernetesNativeAuthService(configuration.KubernetesAuthConfig{})
+	var evictions []recordedEviction
+	authService.CacheEvictions.Sink = func(reason CacheEvictionReason, data CacheData) {
+		evictions = append(evictions, recordedEviction{reason: reason, data: data})
+	}
+	cacheData := CacheData{Name: testName, Valid: true}
+	authService.TokenCache.Set(authService.tokenCacheKey(testToken), cacheData, time.Minute)
+
+	authService.InvalidateToken(testToken)
+
+	assert.Equal(t, []recordedEviction{{reason: CacheEvictionInvalidated, data: cacheData}}, evictions)
+	_, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.False(t, found)
+
+	// Invalidating a token that isn't cached is a no-op.
+	authService.InvalidateToken(testToken)
+	assert.Len(t, evictions, 1)
+}
+
+func TestInvalidateCluster_CacheByCluster(t *testing.T) {
+	const otherUrl = "https://other.config.test:420"
+	kidMappingDir := createKidMappingDir(t)
+	authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+	authService.CacheByCluster = true
+	authService.SetInvalidTokenExpiry(time.Minute)
+	rejectedToken := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+
+	// testToken is accepted and rejectedToken rejected by the cluster testKid maps to.
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	authService.TokenReviewer = &MockTokenReviewer{Authenticated: false}
+	_, err = authService.Authenticate(createAuthContext(rejectedToken))
+	assert.Error(t, err)
+
+	// testKid is then reused by another cluster, which accepts testToken too.
+	assert.NoError(t, os.WriteFile(filepath.Join(kidMappingDir, testKid), []byte(otherUrl), 0o644))
+	authService.TokenReviewer = &MockTokenReviewer{Authenticated: true, Username: testName}
+	info := authenticateWithInfo(t, authService, testToken)
+	assert.False(t, info.FromCache)
+	assert.Len(t, cacheKeys(authService.TokenCache), 3)
+
+	assert.Equal(t, 2, authService.InvalidateCluster("HTTPS://kubernetes.config.test:420/"))
+	assert.Len(t, cacheKeys(authService.TokenCache), 1)
+	info = authenticateWithInfo(t, authService, testToken)
+	assert.True(t, info.FromCache)
+	assert.Equal(t, otherUrl, info.ClusterURL)
+
+	assert.Equal(t, 0, authService.InvalidateCluster(testUrl))
+	assert.Equal(t, 1, authService.InvalidateCluster(otherUrl))
+	assert.Empty(t, cacheKeys(authService.TokenCache))
+}
+
+func TestInvalidateCluster_CacheByToken(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, authService.InvalidateCluster("https://other.config.test:420"))
+	assert.Equal(t, 1, authService.InvalidateCluster(testUrl))
+	_, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.False(t, found)
+}
+
+func TestInvalidateWhere(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenCache.Set("alice-token", CacheData{Name: "alice", Valid: true}, time.Minute)
+	authService.TokenCache.Set("bob-token", CacheData{Name: "bob", Valid: true}, time.Minute)
+	authService.TokenCache.Set("other-alice-token", CacheData{Name: "alice", Valid: true}, time.Minute)
+	authService.TokenCache.Set("rejected-token", CacheData{Valid: false}, time.Minute)
+	authService.TokenCache.Set("corrupt-token", "not cache data", time.Minute)
+
+	removed := authService.InvalidateWhere(func(data CacheData) bool {
+		return data.Name == "alice"
+	})
+
+	assert.Equal(t, 2, removed)
+	for _, key := range []string{"alice-token", "other-alice-token"} {
+		_, found := authService.TokenCache.Get(key)
+		assert.False(t, found, key)
+	}
+	for _, key := range []string{"bob-token", "rejected-token", "corrupt-token"} {
+		_, found := authService.TokenCache.Get(key)
+		assert.True(t, found, key)
+	}
+}
+
+func authenticateWithInfo(t *testing.T, authService KubernetesNativeAuthService, token string) TokenInfo {
+	_, info, err := authService.AuthenticateWithInfo(createAuthContext(token))
+	assert.NoError(t, err)
+	return info
+}
+
+func TestAuthenticate_RemovesCorruptCacheEntries(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	reviewer := &CountingTokenReviewer{Result: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+		Authenticated: true,
+		User:          authv1.UserInfo{Username: testName},
+	}}}
+	authService.TokenReviewer = reviewer
+	key := authService.tokenCacheKey(testToken)
+	authService.TokenCache.Set(key, "not cache data", time.Minute)
+	corruptBefore := testutil.ToFloat64(tokenCacheCorruptEntriesTotal)
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	assert.Equal(t, 1, reviewer.Calls)
+	assert.Equal(t, corruptBefore+1, testutil.ToFloat64(tokenCacheCorruptEntriesTotal))
+	data, found := authService.TokenCache.Get(key)
+	assert.True(t, found)
+	assert.IsType(t, CacheData{}, data)
+}
@@ -0,0 +1,81 @@
+package authorization
+
+import (
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Rough per-entry overhead of the token cache, covering the map entry, cache item and CacheData headers,
+// on top of which the lengths of each entry's strings are counted.
+const tokenCacheEntryOverheadBytes = 200
+
+// TokenCacheSampler periodically records the size of a token cache to metrics, so that its growth can be
+// graphed over time. Sampling continues until either the sampler or the service that started it is stopped.
+type TokenCacheSampler struct {
+	cache    *cache.Cache
+	interval time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// StartTokenCacheSampler samples the size of TokenCache every interval until the returned sampler, or the service,
+// is stopped. Any sampler previously started is stopped.
+func (authService *KubernetesNativeAuthService) StartTokenCacheSampler(interval time.Duration) *TokenCacheSampler {
+	authService.tokenCacheSampler.Stop()
+	sampler := &TokenCacheSampler{
+		cache:    authService.TokenCache,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go sampler.run()
+	authService.tokenCacheSampler = sampler
+	return sampler
+}
+
+func (sampler *TokenCacheSampler) run() {
+	defer close(sampler.done)
+	ticker := time.NewTicker(sampler.interval)
+	defer ticker.Stop()
+	sampler.sample()
+	for {
+		select {
+		case <-ticker.C:
+			sampler.sample()
+		case <-sampler.stop:
+			return
+		}
+	}
+}
+
+func (sampler *TokenCacheSampler) sample() {
+	items := sampler.cache.Items()
+	bytes := 0
+	for key, item := range items {
+		bytes += tokenCacheEntryOverheadBytes + len(key)
+		if data, ok := item.Object.(CacheData); ok {
+			bytes += len(data.Name) + len(data.Kid) + len(data.ClusterURL)
+			for _, group := range data.Groups {
+				bytes += len(group)
+			}
+		}
+	}
+	tokenCacheItems.Set(float64(len(items)))
+	tokenCacheEstimatedBytes.Set(float64(bytes))
+}
+
+// Stop stops sampling, waiting for any sample in progress to complete. It's safe to call more than once,
+// and on a nil sampler.
+func (sampler *TokenCacheSampler) Stop() {
+	if sampler == nil {
+		return
+	}
+	sampler.stopOnce.Do(func() {
+		close(sampler.stop)
+	})
+	<-sampler.done
+}
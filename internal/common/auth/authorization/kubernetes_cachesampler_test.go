@@ -0,0 +1,48 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCacheSampler(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	sampler := authService.StartTokenCacheSampler(5 * time.Millisecond)
+	defer sampler.Stop()
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(tokenCacheItems) == 0
+	}, time.Second, time.Millisecond)
+
+	authService.TokenCache.Set("a", CacheData{Name: testName, Valid: true}, time.Minute)
+	authService.TokenCache.Set("b", CacheData{Valid: false}, time.Minute)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(tokenCacheItems) == 2
+	}, time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, testutil.ToFloat64(tokenCacheEstimatedBytes), float64(2*tokenCacheEntryOverheadBytes+len(testName)))
+
+	// No more samples are taken once stopped.
+	sampler.Stop()
+	authService.TokenCache.Set("c", CacheData{Valid: false}, time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2.0, testutil.ToFloat64(tokenCacheItems))
+}
+
+func TestTokenCacheSampler_StoppedWithService(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	sampler := authService.StartTokenCacheSampler(time.Millisecond)
+
+	authService.Stop()
+	select {
+	case <-sampler.done:
+	default:
+		t.Fatal("sampler still running after the service was stopped")
+	}
+
+	// Stopping either again is harmless.
+	sampler.Stop()
+	authService.Stop()
+}
@@ -0,0 +1,67 @@
+package authorization
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TokenCacheStats summarises the token cache, for serving as JSON from an admin endpoint.
+type TokenCacheStats struct {
+	// Number of unexpired entries, accepted and rejected.
+	Items int `json:"items"`
+	// Number of lookups that found an entry, or didn't, since the service was created.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Earliest and latest expiry of the entries. Omitted if there are none.
+	OldestExpiry *time.Time `json:"oldestExpiry,omitempty"`
+	NewestExpiry *time.Time `json:"newestExpiry,omitempty"`
+}
+
+// CacheLookupCounter counts hits and misses of token cache lookups.
+// All methods are safe to call on a nil counter, which counts nothing.
+type CacheLookupCounter struct {
+	hits   int64
+	misses int64
+}
+
+// Record counts a lookup, as a hit if found is true and a miss otherwise.
+func (counter *CacheLookupCounter) Record(found bool) {
+	if counter == nil {
+		return
+	}
+	if found {
+		atomic.AddInt64(&counter.hits, 1)
+	} else {
+		atomic.AddInt64(&counter.misses, 1)
+	}
+}
+
+// Counts returns the number of hits and misses recorded.
+func (counter *CacheLookupCounter) Counts() (hits int64, misses int64) {
+	if counter == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&counter.hits), atomic.LoadInt64(&counter.misses)
+}
+
+// CacheStats returns statistics about the token cache and lookups of it.
+func (authService *KubernetesNativeAuthService) CacheStats() TokenCacheStats {
+	items := authService.TokenCache.Items()
+	stats := TokenCacheStats{Items: len(items)}
+	stats.Hits, stats.Misses = authService.CacheLookups.Counts()
+	for _, item := range items {
+		if item.Expiration == 0 {
+			continue
+		}
+		expiry := time.Unix(0, item.Expiration)
+		if stats.OldestExpiry == nil || expiry.Before(*stats.OldestExpiry) {
+			oldest := expiry
+			stats.OldestExpiry = &oldest
+		}
+		if stats.NewestExpiry == nil || expiry.After(*stats.NewestExpiry) {
+			newest := expiry
+			stats.NewestExpiry = &newest
+		}
+	}
+	return stats
+}
@@ -0,0 +1,44 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheStats(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.CacheLookups = &CacheLookupCounter{}
+	otherToken := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid), fmt.Sprintf(`{"exp":%d,"sub":"other"}`, testTokenIss+60))
+
+	empty, err := json.Marshal(authService.CacheStats())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"items":0,"hits":0,"misses":0}`, string(empty))
+
+	for _, token := range []string{testToken, testToken, testToken, otherToken} {
+		_, err := authService.Authenticate(createAuthContext(token))
+		assert.NoError(t, err)
+	}
+
+	stats := authService.CacheStats()
+	assert.Equal(t, 2, stats.Items)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	if assert.NotNil(t, stats.OldestExpiry) && assert.NotNil(t, stats.NewestExpiry) {
+		assert.WithinDuration(t, time.Now().Add(time.Minute), *stats.OldestExpiry, 10*time.Second)
+		assert.WithinDuration(t, time.Now().Add(time.Duration(testTokenExp-testTokenIss)*time.Second), *stats.NewestExpiry, 10*time.Second)
+	}
+
+	serialised, err := json.Marshal(stats)
+	assert.NoError(t, err)
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(serialised, &fields))
+	assert.Equal(t, float64(2), fields["items"])
+	assert.Equal(t, float64(2), fields["hits"])
+	assert.Equal(t, float64(2), fields["misses"])
+	assert.Contains(t, fields, "oldestExpiry")
+	assert.Contains(t, fields, "newestExpiry")
+}
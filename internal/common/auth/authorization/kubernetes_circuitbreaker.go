@@ -0,0 +1,133 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// CircuitBreakingTokenReviewer is a TokenReviewer decorator that keeps one circuit breaker per cluster.
+// After FailureThreshold consecutive errors from a cluster, reviews against it fail fast for Cooldown,
+// after which a single probe review is let through; if it succeeds the circuit closes again.
+// This stops a single unreachable API server from consuming the request budget of every authentication.
+// Circuits are keyed by the canonical form of the cluster URL, so equivalent forms of it share a circuit.
+// Only infrastructure failures (5xx and 429 responses, timeouts and connection errors) count towards tripping.
+// A response refusing the token shows the API server is healthy, so counts as a success; other errors, such as
+// cancellation of the caller's context or a bad client-supplied CA, say nothing about the cluster and are ignored.
+type CircuitBreakingTokenReviewer struct {
+	Reviewer         TokenReviewer
+	FailureThreshold int
+	Cooldown         time.Duration
+	Clock            clock.Clock
+
+	mutex    sync.Mutex
+	circuits map[string]*clusterCircuit
+}
+
+type clusterCircuit struct {
+	consecutiveFailures int
+	// Time at which the circuit was tripped. Zero if the circuit is closed.
+	openedAt time.Time
+	// Set while a probe review is in flight for a tripped circuit.
+	probing bool
+}
+
+func NewCircuitBreakingTokenReviewer(reviewer TokenReviewer, failureThreshold int, cooldown time.Duration, clock clock.Clock) *CircuitBreakingTokenReviewer {
+	return &CircuitBreakingTokenReviewer{
+		Reviewer:         reviewer,
+		FailureThreshold: failureThreshold,
+		Cooldown:         cooldown,
+		Clock:            clock,
+		circuits:         map[string]*clusterCircuit{},
+	}
+}
+
+func (reviewer *CircuitBreakingTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	if err := reviewer.acquire(clusterUrl); err != nil {
+		return nil, err
+	}
+
+	result, err := reviewer.Reviewer.ReviewToken(ctx, clusterUrl, token, ca)
+	reviewer.release(ctx, clusterUrl, err)
+	return result, err
+}
+
+// acquire returns an error if the circuit for clusterUrl is open and no probe may be made.
+func (reviewer *CircuitBreakingTokenReviewer) acquire(clusterUrl string) error {
+	reviewer.mutex.Lock()
+	defer reviewer.mutex.Unlock()
+
+	circuit := reviewer.circuit(clusterUrl)
+	if circuit.openedAt.IsZero() {
+		return nil
+	}
+	if open := reviewer.Clock.Since(circuit.openedAt); circuit.probing || open < reviewer.Cooldown {
+		retryAfter := reviewer.Cooldown - open
+		if retryAfter < 0 {
+			// A probe is in flight, so the circuit may close imminently.
+			retryAfter = 0
+		}
+		return &CircuitOpenError{ConsecutiveFailures: circuit.consecutiveFailures, RetryAfter: retryAfter}
+	}
+	circuit.probing = true
+	return nil
+}
+
+// release records the outcome of a review let through by acquire.
+func (reviewer *CircuitBreakingTokenReviewer) release(ctx context.Context, clusterUrl string, err error) {
+	reviewer.mutex.Lock()
+	defer reviewer.mutex.Unlock()
+
+	circuit := reviewer.circuit(clusterUrl)
+	circuit.probing = false
+	if err == nil || isTokenRejection(err) {
+		circuit.consecutiveFailures = 0
+		circuit.openedAt = time.Time{}
+		return
+	}
+	if !isInfrastructureFailure(ctx, err) {
+		return
+	}
+
+	circuit.consecutiveFailures++
+	if circuit.consecutiveFailures >= reviewer.FailureThreshold {
+		circuit.openedAt = reviewer.Clock.Now()
+	}
+}
+
+func (reviewer *CircuitBreakingTokenReviewer) circuit(clusterUrl string) *clusterCircuit {
+	if reviewer.circuits == nil {
+		reviewer.circuits = map[string]*clusterCircuit{}
+	}
+	key, err := canonicalizeClusterURL(clusterUrl)
+	if err != nil {
+		key = clusterUrl
+	}
+	circuit, ok := reviewer.circuits[key]
+	if !ok {
+		circuit = &clusterCircuit{}
+		reviewer.circuits[key] = circuit
+	}
+	return circuit
+}
+
+// CircuitOpenError is returned for reviews against a cluster whose circuit is open. It's temporary, since the
+// review may succeed once the circuit closes. The cluster isn't named, since the error may be returned to clients.
+type CircuitOpenError struct {
+	// Number of consecutive failures that tripped the circuit.
+	ConsecutiveFailures int
+	// How long until the circuit lets a probe review through.
+	RetryAfter time.Duration
+}
+
+func (err *CircuitOpenError) Error() string {
+	return fmt.Sprintf("token review circuit open after %d consecutive failures; retry after %s", err.ConsecutiveFailures, err.RetryAfter)
+}
+
+func (err *CircuitOpenError) Temporary() bool {
+	return true
+}
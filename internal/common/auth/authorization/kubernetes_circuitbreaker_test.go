@@ -0,0 +1,134 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestCircuitBreakingTokenReviewer_TripsAndRecovers(t *testing.T) {
+	const otherUrl = "https://other.config.test:420"
+	fakeClock := clock.NewFakeClock(time.Unix(testTokenIss, 0))
+	wrapped := &CountingTokenReviewer{Err: fmt.Errorf("connection refused")}
+	reviewer := NewCircuitBreakingTokenReviewer(wrapped, 2, time.Minute, fakeClock)
+
+	// Two consecutive failures trip the breaker.
+	for i := 0; i < 2; i++ {
+		_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, wrapped.Calls)
+
+	// While open, reviews fail fast without reaching the cluster.
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.ErrorContains(t, err, "circuit open")
+	assert.Equal(t, 2, wrapped.Calls)
+
+	// Other clusters are unaffected.
+	_, err = reviewer.ReviewToken(context.Background(), otherUrl, testToken, nil)
+	assert.NotContains(t, err.Error(), "circuit open")
+	assert.Equal(t, 3, wrapped.Calls)
+
+	// After the cooldown a probe is let through, and its success closes the circuit.
+	fakeClock.Step(time.Minute)
+	wrapped.Err = nil
+	wrapped.Result = &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}
+	result, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.NoError(t, err)
+	assert.True(t, result.Status.Authenticated)
+	assert.Equal(t, 4, wrapped.Calls)
+
+	_, err = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, wrapped.Calls)
+}
+
+func TestCircuitBreakingTokenReviewer_FailedProbeReopens(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Unix(testTokenIss, 0))
+	wrapped := &CountingTokenReviewer{Err: fmt.Errorf("connection refused")}
+	reviewer := NewCircuitBreakingTokenReviewer(wrapped, 1, time.Minute, fakeClock)
+
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.Error(t, err)
+
+	fakeClock.Step(time.Minute)
+	_, err = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.NotContains(t, err.Error(), "circuit open")
+	assert.Equal(t, 2, wrapped.Calls)
+
+	_, err = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.ErrorContains(t, err, "circuit open")
+	assert.Equal(t, 2, wrapped.Calls)
+}
+
+func TestCircuitBreakingTokenReviewer_CountsOnlyInfrastructureFailures(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Unix(testTokenIss, 0))
+	wrapped := &CountingTokenReviewer{Err: apierrors.NewUnauthorized("Unauthorized")}
+	reviewer := NewCircuitBreakingTokenReviewer(wrapped, 2, time.Minute, fakeClock)
+
+	// Refused tokens show the cluster is healthy.
+	for i := 0; i < 3; i++ {
+		_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+		assert.NotContains(t, err.Error(), "circuit open")
+	}
+
+	// Errors caused by the caller giving up say nothing about the cluster.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wrapped.Err = context.Canceled
+	for i := 0; i < 3; i++ {
+		_, err := reviewer.ReviewToken(ctx, testUrl, testToken, nil)
+		assert.NotContains(t, err.Error(), "circuit open")
+	}
+	assert.Equal(t, 6, wrapped.Calls)
+
+	// Server errors do.
+	wrapped.Err = apierrors.NewServiceUnavailable("unavailable")
+	for i := 0; i < 2; i++ {
+		_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+		assert.NotContains(t, err.Error(), "circuit open")
+	}
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.ErrorContains(t, err, "circuit open")
+	assert.Equal(t, 8, wrapped.Calls)
+}
+
+func TestCircuitBreakingTokenReviewer_RejectionResetsFailures(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Unix(testTokenIss, 0))
+	wrapped := &CountingTokenReviewer{Err: fmt.Errorf("connection refused")}
+	reviewer := NewCircuitBreakingTokenReviewer(wrapped, 2, time.Minute, fakeClock)
+
+	_, _ = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	wrapped.Err = apierrors.NewForbidden(schema.GroupResource{}, "", fmt.Errorf("forbidden"))
+	_, _ = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	wrapped.Err = fmt.Errorf("connection refused")
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.NotContains(t, err.Error(), "circuit open")
+	assert.Equal(t, 3, wrapped.Calls)
+}
+
+func TestCircuitBreakingTokenReviewer_OpenCircuitError(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Unix(testTokenIss, 0))
+	wrapped := &CountingTokenReviewer{Err: fmt.Errorf("connection refused")}
+	reviewer := NewCircuitBreakingTokenReviewer(wrapped, 1, time.Minute, fakeClock)
+
+	_, _ = reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	fakeClock.Step(20 * time.Second)
+
+	// Equivalent forms of the URL share a circuit.
+	_, err := reviewer.ReviewToken(context.Background(), strings.ToUpper(testUrl)+"/", testToken, nil)
+	var open *CircuitOpenError
+	assert.ErrorAs(t, err, &open)
+	assert.Equal(t, 40*time.Second, open.RetryAfter)
+	assert.True(t, IsTemporary(err))
+	assert.NotContains(t, err.Error(), testUrl)
+	assert.Equal(t, 1, wrapped.Calls)
+}
@@ -0,0 +1,67 @@
+package authorization
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Suffixes appended to a kid's mapping file name to get the names of the files holding the PEM-encoded client
+// certificate and key presented when reviewing its tokens.
+const (
+	kidClientCertFileSuffix = ".crt"
+	kidClientKeyFileSuffix  = ".key"
+)
+
+// ClientCertificate is a PEM-encoded client certificate and key presented to clusters requiring mutual TLS.
+type ClientCertificate struct {
+	CertData []byte
+	KeyData  []byte
+}
+
+type tokenReviewClientCertificateKey struct{}
+
+// WithTokenReviewClientCertificate returns a child context requesting that token reviews made with it
+// present the given client certificate.
+func WithTokenReviewClientCertificate(ctx context.Context, cert *ClientCertificate) context.Context {
+	return context.WithValue(ctx, tokenReviewClientCertificateKey{}, cert)
+}
+
+// TokenReviewClientCertificate returns the client certificate attached to ctx by WithTokenReviewClientCertificate,
+// or nil if there is none.
+func TokenReviewClientCertificate(ctx context.Context) *ClientCertificate {
+	cert, _ := ctx.Value(tokenReviewClientCertificateKey{}).(*ClientCertificate)
+	return cert
+}
+
+// clientCertificateForKid returns the client certificate to present when reviewing tokens with the given kid,
+// or nil if PerKidClientCertificates isn't set or the kid has no certificate.
+func (authService *KubernetesNativeAuthService) clientCertificateForKid(kid string) (*ClientCertificate, error) {
+	if !authService.PerKidClientCertificates || authService.usesDefaultCluster(kid) {
+		return nil, nil
+	}
+	name, err := authService.mappingName(kid)
+	if err != nil {
+		return nil, err
+	}
+	certPath := authService.KidMappingFileLocation + name + kidClientCertFileSuffix
+	keyPath := authService.KidMappingFileLocation + name + kidClientKeyFileSuffix
+	certData, certErr := os.ReadFile(certPath)
+	keyData, keyErr := os.ReadFile(keyPath)
+	if errors.Is(certErr, fs.ErrNotExist) && errors.Is(keyErr, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read client certificate for kid %s: %s", kid, certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read client key for kid %s: %s", kid, keyErr)
+	}
+	if _, err := tls.X509KeyPair(certData, keyData); err != nil {
+		return nil, fmt.Errorf("invalid client certificate for kid %s: %s", kid, err)
+	}
+	return &ClientCertificate{CertData: certData, KeyData: keyData}, nil
+}
@@ -0,0 +1,134 @@
+package authorization
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+// ClientCertificateTokenReviewer authenticates every token, recording the client certificate requested.
+type ClientCertificateTokenReviewer struct {
+	RequestedCertificate *ClientCertificate
+}
+
+func (reviewer *ClientCertificateTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	reviewer.RequestedCertificate = TokenReviewClientCertificate(ctx)
+	return &authv1.TokenReview{
+		Status: authv1.TokenReviewStatus{
+			Authenticated: true,
+			User:          authv1.UserInfo{Username: testName},
+		},
+	}, nil
+}
+
+// createTestClientCertificate returns a PEM-encoded self-signed client certificate and its key.
+func createTestClientCertificate(t *testing.T) *ClientCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "armada"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return &ClientCertificate{
+		CertData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyData:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func TestRestConfig_ClientCertificate(t *testing.T) {
+	cert := createTestClientCertificate(t)
+	config := restConfig("https://host", []byte("ca"), cert)
+	assert.Equal(t, "https://host", config.Host)
+	assert.Equal(t, []byte("ca"), config.TLSClientConfig.CAData)
+	assert.Equal(t, cert.CertData, config.TLSClientConfig.CertData)
+	assert.Equal(t, cert.KeyData, config.TLSClientConfig.KeyData)
+
+	config = restConfig("https://host", []byte("ca"), nil)
+	assert.Empty(t, config.TLSClientConfig.CertData)
+	assert.Empty(t, config.TLSClientConfig.KeyData)
+}
+
+func TestKubernetesTokenReviewer_SeparateClientSetsPerClientCertificate(t *testing.T) {
+	reviewer := &KubernetesTokenReviewer{}
+	cert := createTestClientCertificate(t)
+	withoutCert, err := reviewer.clientSet("https://host", nil, nil)
+	assert.NoError(t, err)
+	withCert, err := reviewer.clientSet("https://host", nil, cert)
+	assert.NoError(t, err)
+	again, err := reviewer.clientSet("https://host", nil, &ClientCertificate{CertData: cert.CertData, KeyData: cert.KeyData})
+	assert.NoError(t, err)
+	assert.NotSame(t, withoutCert, withCert)
+	assert.Same(t, withCert, again)
+}
+
+func TestAuthenticate_PerKidClientCertificates(t *testing.T) {
+	cert := createTestClientCertificate(t)
+	tests := map[string]struct {
+		files       map[string][]byte
+		enabled     bool
+		expected    *ClientCertificate
+		expectError bool
+	}{
+		"certificate presented": {
+			files:    map[string][]byte{testKid + ".crt": cert.CertData, testKid + ".key": cert.KeyData},
+			enabled:  true,
+			expected: cert,
+		},
+		"no certificate": {
+			enabled: true,
+		},
+		"disabled": {
+			files: map[string][]byte{testKid + ".crt": cert.CertData, testKid + ".key": cert.KeyData},
+		},
+		"missing key": {
+			files:       map[string][]byte{testKid + ".crt": cert.CertData},
+			enabled:     true,
+			expectError: true,
+		},
+		"mismatched key": {
+			files:       map[string][]byte{testKid + ".crt": cert.CertData, testKid + ".key": createTestClientCertificate(t).KeyData},
+			enabled:     true,
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kidMappingDir := createKidMappingDir(t)
+			for file, contents := range tc.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(kidMappingDir, file), contents, 0o644))
+			}
+			reviewer := &ClientCertificateTokenReviewer{}
+			authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+			authService.TokenReviewer = reviewer
+			authService.PerKidClientCertificates = tc.enabled
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testName, principal.GetName())
+			assert.Equal(t, tc.expected, reviewer.RequestedCertificate)
+		})
+	}
+}
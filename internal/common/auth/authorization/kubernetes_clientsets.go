@@ -0,0 +1,199 @@
+package authorization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	lru "github.com/hashicorp/golang-lru"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// canonicalizeClusterURL normalises clusterUrl so that equivalent forms of the same endpoint compare equal:
+// the scheme and host are lowercased, default ports are dropped and trailing slashes are removed.
+// Errors don't include clusterUrl, or the parser's errors which quote it, since they may be returned to clients
+// and it may not hold a URL at all.
+func canonicalizeClusterURL(clusterUrl string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(clusterUrl))
+	if err != nil {
+		return "", errors.New("invalid cluster URL: unparseable")
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", errors.New("invalid cluster URL: scheme and host are required")
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	hostname := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+	host := hostname
+	if port != "" {
+		host = net.JoinHostPort(hostname, port)
+	} else if strings.Contains(hostname, ":") {
+		host = "[" + hostname + "]"
+	}
+	canonical := url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   strings.TrimRight(parsed.Path, "/"),
+	}
+	return canonical.String(), nil
+}
+
+// WarmClusters builds clientsets for the given clusters ahead of time, so that the first token reviewed against
+// each of them doesn't pay the cost of constructing one. cas holds the CA to use for the cluster at the same
+// index in urls; if nil, no CA is used for any of them. All clusters are attempted, with any failures returned
+// together.
+func (reviewer *KubernetesTokenReviewer) WarmClusters(urls []string, cas [][]byte) error {
+	if cas != nil && len(cas) != len(urls) {
+		return fmt.Errorf("got %d CAs for %d cluster URLs", len(cas), len(urls))
+	}
+	var result *multierror.Error
+	for i, clusterUrl := range urls {
+		var ca []byte
+		if cas != nil {
+			ca = cas[i]
+		}
+		if _, err := reviewer.clientSet(clusterUrl, ca, nil); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// Number of clientsets KubernetesTokenReviewer pools if MaxClientSets isn't set.
+const defaultMaxClientSets = 256
+
+// pooledClientSet is a clientset along with the transport underlying it, so that the transport's idle
+// connections can be closed once the clientset leaves the pool.
+type pooledClientSet struct {
+	clientSet kubernetes.Interface
+	transport http.RoundTripper
+}
+
+// clientSet returns the clientset for the given cluster, CA and client certificate, creating it if this is the
+// first request for them. cert may be nil, in which case no client certificate is presented.
+// Clientsets don't carry credentials; the token to authenticate with is attached to each request's context.
+func (reviewer *KubernetesTokenReviewer) clientSet(clusterUrl string, ca []byte, cert *ClientCertificate) (kubernetes.Interface, error) {
+	canonicalUrl, err := canonicalizeClusterURL(clusterUrl)
+	if err != nil {
+		return nil, err
+	}
+	caHash := sha256.Sum256(ca)
+	key := canonicalUrl + "|" + hex.EncodeToString(caHash[:])
+	if cert != nil {
+		certHash := sha256.Sum256(append(append([]byte{}, cert.CertData...), cert.KeyData...))
+		key += "|" + hex.EncodeToString(certHash[:])
+	}
+
+	reviewer.mutex.Lock()
+	defer reviewer.mutex.Unlock()
+	if reviewer.clientSets == nil {
+		size := reviewer.MaxClientSets
+		if size <= 0 {
+			size = defaultMaxClientSets
+		}
+		reviewer.clientSets, err = lru.NewWithEvict(size, func(_ interface{}, value interface{}) {
+			if closer, ok := value.(*pooledClientSet).transport.(interface{ CloseIdleConnections() }); ok {
+				closer.CloseIdleConnections()
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pooled, ok := reviewer.clientSets.Get(key); ok {
+		return pooled.(*pooledClientSet).clientSet, nil
+	}
+	config := restConfig(canonicalUrl, ca, cert)
+	config.Timeout = reviewer.Timeout
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTokenReviewTimeout
+	}
+	pooled, err := newPooledClientSet(config)
+	if err != nil {
+		return nil, err
+	}
+	reviewer.clientSets.Add(key, pooled)
+	return pooled.clientSet, nil
+}
+
+// newPooledClientSet creates a clientset using a single transport built from config. The transport is kept out of
+// client-go's global transport cache, which is keyed by CA and never evicted, so that it's released along with
+// the clientset.
+func newPooledClientSet(config *rest.Config) (*pooledClientSet, error) {
+	pooled := &pooledClientSet{}
+	// client-go doesn't cache transports for configs with a Proxy func.
+	config.Proxy = http.ProxyFromEnvironment
+	wrap := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		pooled.transport = rt
+		return wrap(rt)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+	pooled.clientSet, err = kubernetes.NewForConfig(&rest.Config{Host: config.Host, Transport: transport, Timeout: config.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	return pooled, nil
+}
+
+// pooledClientSets returns the number of clientsets in the pool.
+func (reviewer *KubernetesTokenReviewer) pooledClientSets() int {
+	reviewer.mutex.Lock()
+	defer reviewer.mutex.Unlock()
+	if reviewer.clientSets == nil {
+		return 0
+	}
+	return reviewer.clientSets.Len()
+}
+
+// restConfig returns the config for clients of the given cluster, trusting ca and presenting cert, if non-nil.
+func restConfig(clusterUrl string, ca []byte, cert *ClientCertificate) *rest.Config {
+	config := &rest.Config{
+		Host:            clusterUrl,
+		TLSClientConfig: rest.TLSClientConfig{CAData: ca},
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &contextBearerRoundTripper{next: rt}
+		},
+	}
+	if cert != nil {
+		config.TLSClientConfig.CertData = cert.CertData
+		config.TLSClientConfig.KeyData = cert.KeyData
+	}
+	return config
+}
+
+type bearerTokenKey struct{}
+
+func withBearerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, bearerTokenKey{}, token)
+}
+
+// contextBearerRoundTripper authenticates requests with the bearer token attached to their context,
+// allowing a single clientset to be shared between requests made on behalf of different tokens.
+type contextBearerRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt *contextBearerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, ok := req.Context().Value(bearerTokenKey{}).(string)
+	if !ok || token == "" {
+		return rt.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,176 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func TestCanonicalizeClusterURL(t *testing.T) {
+	tests := map[string]struct {
+		url         string
+		expected    string
+		expectError bool
+	}{
+		"already canonical":  {url: "https://host", expected: "https://host"},
+		"default https port": {url: "https://host:443", expected: "https://host"},
+		"default http port":  {url: "http://host:80", expected: "http://host"},
+		"non-default port":   {url: "https://host:6443", expected: "https://host:6443"},
+		"trailing slash":     {url: "https://host/", expected: "https://host"},
+		"uppercase host":     {url: "HTTPS://Host.Example.COM:443/", expected: "https://host.example.com"},
+		"path kept":          {url: "https://host/k8s/", expected: "https://host/k8s"},
+		"ipv6 default port":  {url: "https://[::1]:443", expected: "https://[::1]"},
+		"ipv6 explicit port": {url: "https://[::1]:6443", expected: "https://[::1]:6443"},
+		"surrounding spaces": {url: " https://host\n", expected: "https://host"},
+		"missing scheme":     {url: "host:443", expectError: true},
+		"unparseable":        {url: "https://host:port", expectError: true},
+		"empty":              {url: "", expectError: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			canonical, err := canonicalizeClusterURL(tc.url)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, canonical)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeClusterURL_ErrorsOmitInput(t *testing.T) {
+	for _, input := range []string{"secret-contents", "https://host:secret-contents"} {
+		_, err := canonicalizeClusterURL(input)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "secret-contents")
+	}
+}
+
+func TestKubernetesTokenReviewer_SharesClientSetsForEquivalentURLs(t *testing.T) {
+	reviewer := &KubernetesTokenReviewer{}
+
+	first, err := reviewer.clientSet("https://Host:443/", nil, nil)
+	assert.NoError(t, err)
+	second, err := reviewer.clientSet("https://host", nil, nil)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+
+	otherCluster, err := reviewer.clientSet("https://host:6443", nil, nil)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, otherCluster)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	otherCA, err := reviewer.clientSet("https://host", ca, nil)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, otherCA)
+}
+
+func TestKubernetesTokenReviewer_AuthenticatesWithReviewedToken(t *testing.T) {
+	var authorizationHeaders []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizationHeaders = append(authorizationHeaders, r.Header.Get("Authorization"))
+		var review authv1.TokenReview
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		review.Status.Authenticated = true
+		review.Status.User.Username = testName
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(review))
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	reviewer := &KubernetesTokenReviewer{}
+	for _, token := range []string{"first-token", "second-token"} {
+		result, err := reviewer.ReviewToken(context.Background(), server.URL, token, ca)
+		assert.NoError(t, err)
+		assert.True(t, result.Status.Authenticated)
+		assert.Equal(t, token, result.Spec.Token)
+	}
+	assert.Equal(t, []string{"Bearer first-token", "Bearer second-token"}, authorizationHeaders)
+	assert.Equal(t, 1, reviewer.pooledClientSets())
+}
+
+func TestKubernetesTokenReviewer_ObservesSizes(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review authv1.TokenReview
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		review.Status.Authenticated = true
+		review.Status.User.Username = testName
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(review))
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	tokenSamplesBefore := histogramSampleCount(t, tokenReviewTokenBytes)
+	tokenSumBefore := histogramSampleSum(t, tokenReviewTokenBytes)
+	responseSamplesBefore := histogramSampleCount(t, tokenReviewResponseBytes)
+
+	reviewer := &KubernetesTokenReviewer{}
+	_, err := reviewer.ReviewToken(context.Background(), server.URL, "twelve-bytes", ca)
+	assert.NoError(t, err)
+
+	assert.Equal(t, tokenSamplesBefore+1, histogramSampleCount(t, tokenReviewTokenBytes))
+	assert.Equal(t, tokenSumBefore+12, histogramSampleSum(t, tokenReviewTokenBytes))
+	assert.Equal(t, responseSamplesBefore+1, histogramSampleCount(t, tokenReviewResponseBytes))
+}
+
+func TestKubernetesTokenReviewer_BoundsClientSetPool(t *testing.T) {
+	reviewer := &KubernetesTokenReviewer{MaxClientSets: 2}
+	first, err := reviewer.clientSet("https://first", nil, nil)
+	assert.NoError(t, err)
+	for _, url := range []string{"https://second", "https://third", "https://fourth"} {
+		_, err := reviewer.clientSet(url, nil, nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, reviewer.pooledClientSets())
+
+	recreated, err := reviewer.clientSet("https://first", nil, nil)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, recreated)
+	assert.Equal(t, 2, reviewer.pooledClientSets())
+}
+
+func TestKubernetesTokenReviewer_WarmClusters(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review authv1.TokenReview
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		review.Status.Authenticated = true
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(review))
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	reviewer := &KubernetesTokenReviewer{}
+	assert.NoError(t, reviewer.WarmClusters([]string{server.URL, "https://other-cluster"}, [][]byte{ca, nil}))
+	assert.Equal(t, 2, reviewer.pooledClientSets())
+	warmed, err := reviewer.clientSet(server.URL, ca, nil)
+	assert.NoError(t, err)
+
+	_, err = reviewer.ReviewToken(context.Background(), server.URL, "token", ca)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reviewer.pooledClientSets())
+	reviewed, err := reviewer.clientSet(server.URL, ca, nil)
+	assert.NoError(t, err)
+	assert.Same(t, warmed, reviewed)
+}
+
+func TestKubernetesTokenReviewer_WarmClusters_Errors(t *testing.T) {
+	reviewer := &KubernetesTokenReviewer{}
+	assert.Error(t, reviewer.WarmClusters([]string{"https://host"}, [][]byte{nil, nil}))
+	assert.Zero(t, reviewer.pooledClientSets())
+
+	err := reviewer.WarmClusters([]string{"not a url", "https://host", "host:443"}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 errors occurred")
+	assert.Equal(t, 1, reviewer.pooledClientSets())
+}
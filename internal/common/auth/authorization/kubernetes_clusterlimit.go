@@ -0,0 +1,67 @@
+package authorization
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ClusterLimiter caps the number of distinct clusters tokens are reviewed against, bounding the per-cluster state,
+// such as circuit breakers, that tokens carrying a large number of distinct kids could otherwise accumulate.
+// It doesn't bound pooled clientsets, which are also keyed by client-supplied CAs; see
+// KubernetesTokenReviewer.MaxClientSets.
+// Clusters are admitted on first use and never forgotten, so the cap should comfortably exceed the number of
+// legitimate clusters. All methods are safe to call on a nil limiter, which admits every cluster.
+type ClusterLimiter struct {
+	Max int
+
+	mutex    sync.Mutex
+	clusters map[string]struct{}
+}
+
+func NewClusterLimiter(max int) *ClusterLimiter {
+	return &ClusterLimiter{
+		Max:      max,
+		clusters: map[string]struct{}{},
+	}
+}
+
+// Admit returns an error if clusterUrl hasn't been seen before and Max distinct clusters already have been.
+// Equivalent forms of the same URL count as a single cluster.
+func (limiter *ClusterLimiter) Admit(clusterUrl string) error {
+	if limiter == nil {
+		return nil
+	}
+	key, err := canonicalizeClusterURL(clusterUrl)
+	if err != nil {
+		key = clusterUrl
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if _, ok := limiter.clusters[key]; ok {
+		return nil
+	}
+	if len(limiter.clusters) >= limiter.Max {
+		clusterLimitRejectionsTotal.Inc()
+		// The cluster is only logged, since the error may be returned to clients.
+		log.Warnf("rejecting token for cluster %s: the limit of %d distinct clusters has been reached", clusterUrl, limiter.Max)
+		return &tokenRejectedError{fmt.Sprintf("cluster rejected: the limit of %d distinct clusters has been reached", limiter.Max)}
+	}
+	if limiter.clusters == nil {
+		limiter.clusters = map[string]struct{}{}
+	}
+	limiter.clusters[key] = struct{}{}
+	return nil
+}
+
+// Len returns the number of distinct clusters admitted.
+func (limiter *ClusterLimiter) Len() int {
+	if limiter == nil {
+		return 0
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return len(limiter.clusters)
+}
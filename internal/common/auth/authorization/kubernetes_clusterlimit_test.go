@@ -0,0 +1,44 @@
+package authorization
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterLimiter_RejectsClustersBeyondMax(t *testing.T) {
+	limiter := NewClusterLimiter(3)
+	rejectionsBefore := testutil.ToFloat64(clusterLimitRejectionsTotal)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.Admit(fmt.Sprintf("https://cluster-%d", i)))
+	}
+	// Clusters already admitted, in any form, are still accepted.
+	assert.NoError(t, limiter.Admit("https://cluster-0"))
+	assert.NoError(t, limiter.Admit("HTTPS://Cluster-1:443/"))
+
+	err := limiter.Admit("https://cluster-3")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "limit of 3 distinct clusters")
+	assert.NotContains(t, err.Error(), "cluster-3")
+	assert.Equal(t, 3, limiter.Len())
+	assert.Equal(t, rejectionsBefore+1, testutil.ToFloat64(clusterLimitRejectionsTotal))
+}
+
+func TestClusterLimiter_Nil(t *testing.T) {
+	var limiter *ClusterLimiter
+	assert.NoError(t, limiter.Admit("https://cluster"))
+	assert.Equal(t, 0, limiter.Len())
+}
+
+func TestAuthenticate_RejectsClustersBeyondLimit(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.ClusterLimiter = NewClusterLimiter(1)
+	assert.NoError(t, authService.ClusterLimiter.Admit("https://other-cluster"))
+
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "distinct clusters")
+}
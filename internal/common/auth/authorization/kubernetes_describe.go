@@ -0,0 +1,104 @@
+package authorization
+
+import (
+	"fmt"
+	"time"
+)
+
+// KubernetesAuthDescription is a snapshot of the effective settings of a KubernetesNativeAuthService, for
+// diagnostics. It never contains tokens, CAs or other credential material, so is safe to log.
+type KubernetesAuthDescription struct {
+	KidMappingSource          string        `json:"kidMappingSource"`
+	KidMappingLocation        string        `json:"kidMappingLocation"`
+	KidPrefix                 string        `json:"kidPrefix,omitempty"`
+	KidSeparator              string        `json:"kidSeparator,omitempty"`
+	AllowTokensWithoutKid     bool          `json:"allowTokensWithoutKid"`
+	DefaultClusterURL         string        `json:"defaultClusterURL,omitempty"`
+	CustomKidValidator        bool          `json:"customKidValidator"`
+	StrictTokenHeader         bool          `json:"strictTokenHeader"`
+	AllowedTokenTypes         []string      `json:"allowedTokenTypes,omitempty"`
+	MetadataKey               string        `json:"metadataKey"`
+	InvalidTokenExpiry        time.Duration `json:"invalidTokenExpiry"`
+	MaxIssuedAtSkew           time.Duration `json:"maxIssuedAtSkew"`
+	ClockSkewLeeway           time.Duration `json:"clockSkewLeeway"`
+	AllowNonExpiringTokens    bool          `json:"allowNonExpiringTokens"`
+	NonExpiringTokenCacheTTL  time.Duration `json:"nonExpiringTokenCacheTTL,omitempty"`
+	CacheRefreshThreshold     time.Duration `json:"cacheRefreshThreshold"`
+	CachedTokens              int           `json:"cachedTokens"`
+	CacheByCluster            bool          `json:"cacheByCluster"`
+	Audiences                 []string      `json:"audiences,omitempty"`
+	PerKidAudiences           bool          `json:"perKidAudiences"`
+	PerKidClientCertificates  bool          `json:"perKidClientCertificates"`
+	AllowedNamespaces         []string      `json:"allowedNamespaces,omitempty"`
+	StaticJWKSDirectory       string        `json:"staticJwksDirectory,omitempty"`
+	SplitUsernameGroups       bool          `json:"splitUsernameGroups"`
+	UseTokenReviewGroups      bool          `json:"useTokenReviewGroups"`
+	DefaultGroups             []string      `json:"defaultGroups,omitempty"`
+	ExcludeUsernameFromGroups bool          `json:"excludeUsernameFromGroups"`
+	PostAuthHook              bool          `json:"postAuthHook"`
+	AuditSink                 bool          `json:"auditSink"`
+	CoalesceReviews           bool          `json:"coalesceReviews"`
+	TokenReviewTimeout        time.Duration `json:"tokenReviewTimeout"`
+	MaxDistinctClusters       int           `json:"maxDistinctClusters,omitempty"`
+	DistinctClusters          int           `json:"distinctClusters"`
+	DisablePanicRecovery      bool          `json:"disablePanicRecovery"`
+}
+
+// DescribeConfig returns a snapshot of the service's effective settings, with any credential material left out.
+// Hooks and validators are reported only by whether they're set.
+func (authService *KubernetesNativeAuthService) DescribeConfig() KubernetesAuthDescription {
+	description := KubernetesAuthDescription{
+		KidPrefix:                 authService.KidPrefix,
+		KidSeparator:              authService.KidSeparator,
+		AllowTokensWithoutKid:     authService.AllowTokensWithoutKid,
+		DefaultClusterURL:         authService.DefaultClusterURL,
+		CustomKidValidator:        authService.KidValidator != nil,
+		StrictTokenHeader:         authService.StrictTokenHeader,
+		AllowedTokenTypes:         append([]string(nil), authService.AllowedTokenTypes...),
+		MetadataKey:               authService.metadataKey(),
+		InvalidTokenExpiry:        authService.invalidTokenExpiry(),
+		MaxIssuedAtSkew:           authService.MaxIssuedAtSkew,
+		ClockSkewLeeway:           authService.ClockSkewLeeway,
+		AllowNonExpiringTokens:    authService.AllowNonExpiringTokens,
+		NonExpiringTokenCacheTTL:  authService.NonExpiringTokenCacheTTL,
+		CacheRefreshThreshold:     authService.CacheRefreshThreshold,
+		CacheByCluster:            authService.CacheByCluster,
+		Audiences:                 append([]string(nil), authService.Audiences...),
+		PerKidAudiences:           authService.PerKidAudiences,
+		PerKidClientCertificates:  authService.PerKidClientCertificates,
+		AllowedNamespaces:         append([]string(nil), authService.AllowedNamespaces...),
+		SplitUsernameGroups:       authService.SplitUsernameGroups,
+		UseTokenReviewGroups:      authService.UseTokenReviewGroups,
+		DefaultGroups:             append([]string(nil), authService.DefaultGroups...),
+		ExcludeUsernameFromGroups: authService.ExcludeUsernameFromGroups,
+		PostAuthHook:              authService.PostAuthHook != nil,
+		AuditSink:                 authService.AuditSink != nil,
+		CoalesceReviews:           authService.ReviewGroup != nil,
+		TokenReviewTimeout:        authService.tokenReviewTimeout(),
+		DistinctClusters:          authService.ClusterLimiter.Len(),
+		DisablePanicRecovery:      authService.DisablePanicRecovery,
+	}
+	switch source := authService.kidMappingSource().(type) {
+	case *DirectoryKidMappingSource:
+		description.KidMappingSource = "directory"
+		description.KidMappingLocation = source.Location
+	case *FileKidMappingSource:
+		description.KidMappingSource = "file"
+		description.KidMappingLocation = source.Path
+	case *SecretKidMappingSource:
+		description.KidMappingSource = "secret"
+		description.KidMappingLocation = source.Namespace + "/" + source.Name
+	default:
+		description.KidMappingSource = fmt.Sprintf("%T", source)
+	}
+	if authService.TokenCache != nil {
+		description.CachedTokens = authService.TokenCache.ItemCount()
+	}
+	if authService.JWKSVerifier != nil {
+		description.StaticJWKSDirectory = authService.JWKSVerifier.Directory
+	}
+	if authService.ClusterLimiter != nil {
+		description.MaxDistinctClusters = authService.ClusterLimiter.Max
+	}
+	return description
+}
@@ -0,0 +1,44 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeConfig(t *testing.T) {
+	ca := createTestCA(t)
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.SetInvalidTokenExpiry(time.Minute)
+	authService.MaxIssuedAtSkew = 30 * time.Second
+	authService.ClusterLimiter = NewClusterLimiter(10)
+
+	md := metautils.ExtractIncoming(context.Background())
+	md.Set("authorization", createKubernetesAuthPayload(testToken, ca))
+	_, err := authService.Authenticate(md.ToIncoming(context.Background()))
+	assert.NoError(t, err)
+	authService.Audiences = []string{"armada"}
+
+	description := authService.DescribeConfig()
+	assert.Equal(t, "directory", description.KidMappingSource)
+	assert.Equal(t, authService.KidMappingFileLocation, description.KidMappingLocation)
+	assert.Equal(t, "authorization", description.MetadataKey)
+	assert.Equal(t, time.Minute, description.InvalidTokenExpiry)
+	assert.Equal(t, 30*time.Second, description.MaxIssuedAtSkew)
+	assert.Equal(t, []string{"armada"}, description.Audiences)
+	assert.Equal(t, 1, description.CachedTokens)
+	assert.Equal(t, 10, description.MaxDistinctClusters)
+	assert.Equal(t, 1, description.DistinctClusters)
+	assert.False(t, description.PostAuthHook)
+
+	serialised, err := json.Marshal(description)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(serialised), testToken)
+	assert.NotContains(t, string(serialised), strings.Split(ca, "\n")[1])
+	assert.NotContains(t, string(serialised), authService.tokenCacheKey(testToken))
+}
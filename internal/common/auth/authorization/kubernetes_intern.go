@@ -0,0 +1,46 @@
+package authorization
+
+import "sync"
+
+// Maximum number of distinct strings held by a stringInterner. Beyond it, strings are returned uninterned,
+// so that a flood of distinct usernames can't grow the pool without bound.
+const maxInternedStrings = 10000
+
+// stringInterner deduplicates strings, such as usernames and groups, that are repeated across many cache entries,
+// so that equal strings share backing storage. A nil stringInterner returns strings unchanged.
+type stringInterner struct {
+	mutex   sync.Mutex
+	strings map[string]string
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{strings: map[string]string{}}
+}
+
+// intern returns a string equal to s, sharing storage with previously interned equal strings.
+func (interner *stringInterner) intern(s string) string {
+	if interner == nil {
+		return s
+	}
+	interner.mutex.Lock()
+	defer interner.mutex.Unlock()
+	if interned, ok := interner.strings[s]; ok {
+		return interned
+	}
+	if len(interner.strings) < maxInternedStrings {
+		interner.strings[s] = s
+	}
+	return s
+}
+
+// internAll returns a copy of strings with each element interned.
+func (interner *stringInterner) internAll(strings []string) []string {
+	if interner == nil || strings == nil {
+		return strings
+	}
+	interned := make([]string, len(strings))
+	for i, s := range strings {
+		interned[i] = interner.intern(s)
+	}
+	return interned
+}
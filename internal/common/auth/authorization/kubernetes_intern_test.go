@@ -0,0 +1,68 @@
+package authorization
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestStringInterner(t *testing.T) {
+	interner := newStringInterner()
+	// Build equal strings with distinct backing storage.
+	first := strings.Repeat("a", 8)
+	second := strings.Repeat("a", 8)
+	assert.NotEqual(t, stringData(first), stringData(second))
+
+	assert.Equal(t, stringData(first), stringData(interner.intern(first)))
+	assert.Equal(t, stringData(first), stringData(interner.intern(second)))
+
+	var nilInterner *stringInterner
+	assert.Equal(t, stringData(second), stringData(nilInterner.intern(second)))
+}
+
+func TestStringInterner_Bounded(t *testing.T) {
+	interner := newStringInterner()
+	for i := 0; i < maxInternedStrings+10; i++ {
+		interner.intern(fmt.Sprintf("user-%d", i))
+	}
+	assert.Len(t, interner.strings, maxInternedStrings)
+}
+
+func TestAuthenticate_InternsUsernamesAndGroups(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, "", testTokenIss)
+	authService.interner = newStringInterner()
+	reviewer := &CountingTokenReviewer{}
+	authService.TokenReviewer = reviewer
+	header := fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid)
+
+	var cached []CacheData
+	for i := 0; i < 2; i++ {
+		// Each review returns equal strings with distinct backing storage, as decoding a response would.
+		reviewer.Result = &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+			Authenticated: true,
+			User: authv1.UserInfo{
+				Username: string([]byte(testName)),
+				Groups:   []string{string([]byte("group-a"))},
+			},
+		}}
+		token := createTestJWT(header, fmt.Sprintf(`{"exp":%d,"sub":"%d"}`, testTokenExp, i))
+		_, err := authService.Authenticate(createAuthContext(token))
+		assert.NoError(t, err)
+		data, found := authService.TokenCache.Get(authService.tokenCacheKey(token))
+		assert.True(t, found)
+		cached = append(cached, data.(CacheData))
+	}
+
+	assert.Equal(t, cached[0].Name, cached[1].Name)
+	assert.Equal(t, stringData(cached[0].Name), stringData(cached[1].Name))
+	assert.Equal(t, stringData(cached[0].Groups[0]), stringData(cached[1].Groups[0]))
+}
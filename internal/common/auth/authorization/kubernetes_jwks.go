@@ -0,0 +1,101 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Suffix appended to a kid's mapping file name to get the name of the JWKS file pinning its cluster's keys.
+const staticJWKSFileSuffix = ".jwks"
+
+// StaticJWKSVerifier verifies token signatures locally against JSON Web Key Sets pinned on disk,
+// for clusters whose JWKS endpoints can't be reached (e.g., air-gapped clusters).
+// Each key set is read from Directory and reloaded whenever its file changes, so keys can be rotated without a restart.
+type StaticJWKSVerifier struct {
+	// Directory containing the key sets. Used as a prefix, so should end with a path separator.
+	Directory string
+
+	mutex   sync.Mutex
+	keySets map[string]*staticKeySet
+}
+
+type staticKeySet struct {
+	modTime time.Time
+	keys    jose.JSONWebKeySet
+}
+
+func NewStaticJWKSVerifier(directory string) *StaticJWKSVerifier {
+	return &StaticJWKSVerifier{
+		Directory: directory,
+		keySets:   map[string]*staticKeySet{},
+	}
+}
+
+// Verify returns an error unless token is signed by the key identified by kid in the key set named name.
+func (verifier *StaticJWKSVerifier) Verify(name string, kid string, token string) error {
+	keySet, err := verifier.load(name)
+	if err != nil {
+		return err
+	}
+	keys := keySet.Key(kid)
+	if len(keys) == 0 {
+		return fmt.Errorf("token signed by unknown key %s", kid)
+	}
+
+	signed, err := jose.ParseSigned(token)
+	if err != nil {
+		return fmt.Errorf("failed to parse token signature: %s", err)
+	}
+	for _, key := range keys {
+		if _, err := signed.Verify(key.Key); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("token signature does not match pinned key %s", kid)
+}
+
+// load returns the key set named name, re-reading its file only if it has been modified since the last load.
+func (verifier *StaticJWKSVerifier) load(name string) (jose.JSONWebKeySet, error) {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+
+	path := verifier.Directory + name + staticJWKSFileSuffix
+	info, err := os.Stat(path)
+	if err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("no pinned JWKS found for %s: %s", name, err)
+	}
+	if cached, ok := verifier.keySets[name]; ok && info.ModTime().Equal(cached.modTime) {
+		return cached.keys, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(contents, &keys); err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("failed to parse JWKS file %s: %s", path, err)
+	}
+
+	if verifier.keySets == nil {
+		verifier.keySets = map[string]*staticKeySet{}
+	}
+	verifier.keySets[name] = &staticKeySet{modTime: info.ModTime(), keys: keys}
+	return keys, nil
+}
+
+func (authService *KubernetesNativeAuthService) verifyWithStaticJWKS(kid string, token string) error {
+	name, err := authService.mappingName(kid)
+	if err != nil {
+		return err
+	}
+	if err := authService.JWKSVerifier.Verify(name, kid, token); err != nil {
+		return &tokenRejectedError{fmt.Sprintf("token failed local signature verification: %s", err)}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package authorization
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithHeader("kid", kid).WithType("JWT"),
+	)
+	assert.NoError(t, err)
+	signed, err := signer.Sign([]byte(fmt.Sprintf(`{"exp":%d,"iat":%d}`, testTokenExp, testTokenIss)))
+	assert.NoError(t, err)
+	token, err := signed.CompactSerialize()
+	assert.NoError(t, err)
+	return token
+}
+
+func writeTestJWKS(t *testing.T, dir string, name string, kid string, key *rsa.PrivateKey) {
+	keySet := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: kid, Algorithm: "RS256", Use: "sig"}}}
+	contents, err := json.Marshal(keySet)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+staticJWKSFileSuffix), contents, 0o644))
+}
+
+func TestAuthenticate_StaticJWKS(t *testing.T) {
+	trustedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	unknownKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	kidMappingDir := createKidMappingDir(t)
+	writeTestJWKS(t, kidMappingDir, testKid, testKid, trustedKey)
+
+	authService := createTestAuthService(kidMappingDir, true, testName, testTokenIss)
+	authService.JWKSVerifier = NewStaticJWKSVerifier(kidMappingDir)
+
+	principal, err := authService.Authenticate(createAuthContext(signTestJWT(t, trustedKey, testKid)))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	principal, err = authService.Authenticate(createAuthContext(signTestJWT(t, unknownKey, testKid)))
+	assert.ErrorContains(t, err, "signature")
+	assert.Nil(t, principal)
+}
+
+func TestStaticJWKSVerifier_MissingKeySet(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	verifier := NewStaticJWKSVerifier(t.TempDir() + "/")
+	assert.Error(t, verifier.Verify(testKid, testKid, signTestJWT(t, key, testKid)))
+}
@@ -0,0 +1,303 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/yaml"
+)
+
+// Supported values for KubernetesAuthConfig.KidMappingMode.
+const (
+	// KidMappingFileLocation is a directory containing one file per kid, each holding a cluster URL.
+	KidMappingModeDirectory = "directory"
+	// KidMappingFileLocation is a single JSON or YAML file holding a map from kid to cluster URL.
+	KidMappingModeFile = "file"
+)
+
+// KidMappingSource resolves the URL of the cluster that issued tokens with a given kid.
+type KidMappingSource interface {
+	GetClusterURL(kid string) (string, error)
+}
+
+// errNoKidMapping is returned, wrapped, by KidMappingSources when a kid has no mapping.
+var errNoKidMapping = errors.New("no cluster mapping found")
+
+// DirectoryKidMappingSource reads the cluster URL for each kid from the file named after that kid in Location.
+// Location is used as a prefix and should therefore end with a path separator.
+type DirectoryKidMappingSource struct {
+	Location string
+	// Clock deciding when the directory is next scanned for metrics. May be nil, in which case the real clock is used.
+	Clock clock.Clock
+
+	mutex    sync.Mutex
+	lastScan time.Time
+	// Deduplicates the URLs read, which many kids of the same cluster share. May be nil, in which case
+	// each read returns a new copy.
+	urls *stringInterner
+}
+
+func NewDirectoryKidMappingSource(location string) *DirectoryKidMappingSource {
+	return &DirectoryKidMappingSource{Location: location, Clock: clock.RealClock{}, urls: newStringInterner()}
+}
+
+// Default kid mapping sources of services that don't set KidMappingSource, keyed by location and clock, so that
+// each is created once rather than on every lookup.
+var defaultKidMappingSources sync.Map
+
+type defaultKidMappingSourceKey struct {
+	location string
+	clock    clock.Clock
+}
+
+// defaultKidMappingSource returns the DirectoryKidMappingSource for location whose scans are driven by clock,
+// creating it on first use.
+func defaultKidMappingSource(location string, clock clock.Clock) *DirectoryKidMappingSource {
+	key := defaultKidMappingSourceKey{location: location, clock: clock}
+	if source, ok := defaultKidMappingSources.Load(key); ok {
+		return source.(*DirectoryKidMappingSource)
+	}
+	source := NewDirectoryKidMappingSource(location)
+	if clock != nil {
+		source.Clock = clock
+	}
+	actual, _ := defaultKidMappingSources.LoadOrStore(key, source)
+	return actual.(*DirectoryKidMappingSource)
+}
+
+func (source *DirectoryKidMappingSource) GetClusterURL(kid string) (string, error) {
+	// Kids are validated before reaching here, but a custom KidValidator may not guard against path traversal.
+	if kid == "" || strings.ContainsAny(kid, `/\`) || kid == "." || kid == ".." {
+		return "", fmt.Errorf("kid %s can't be used as a kid mapping file name", kid)
+	}
+	// Nor may kids name the sidecar files held alongside mappings, some of which, such as client keys, are secret.
+	if !isKidMappingFileName(kid) {
+		return "", fmt.Errorf("%w for kid %s in %s", errNoKidMapping, kid, source.Location)
+	}
+	source.scanIfDue()
+	url, err := os.ReadFile(source.Location + kid)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w for kid %s in %s", errNoKidMapping, kid, source.Location)
+	}
+	if err != nil {
+		return "", err
+	}
+	return source.urls.intern(string(url)), nil
+}
+
+// FileKidMappingSource reads the cluster URLs for all kids from a single JSON or YAML file holding a map
+// from kid to URL, e.g., the data of a ConfigMap. The file is held in memory and reloaded whenever its
+// modification time changes.
+type FileKidMappingSource struct {
+	Path string
+
+	mutex    sync.Mutex
+	modTime  time.Time
+	mappings map[string]string
+}
+
+func NewFileKidMappingSource(path string) *FileKidMappingSource {
+	return &FileKidMappingSource{Path: path}
+}
+
+func (source *FileKidMappingSource) GetClusterURL(kid string) (string, error) {
+	mappings, err := source.load()
+	if err != nil {
+		return "", err
+	}
+	url, ok := mappings[kid]
+	if !ok {
+		return "", fmt.Errorf("%w for kid %s in %s", errNoKidMapping, kid, source.Path)
+	}
+	return url, nil
+}
+
+// load returns the mappings currently in the file, re-reading it only if it has been modified since the last load.
+func (source *FileKidMappingSource) load() (map[string]string, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	if source.mappings != nil && info.ModTime().Equal(source.modTime) {
+		return source.mappings, nil
+	}
+
+	contents, err := os.ReadFile(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	mappings := map[string]string{}
+	if err := yaml.Unmarshal(contents, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse kid mapping file %s: %s", source.Path, err)
+	}
+
+	source.mappings = mappings
+	source.modTime = info.ModTime()
+	oldestKidMappingModTime.Set(float64(info.ModTime().Unix()))
+	return mappings, nil
+}
+
+// Minimum interval between scans of a kid mapping directory for the modification time of its oldest file.
+const kidMappingScanInterval = time.Minute
+
+// scanIfDue starts a scan of the directory updating the oldestKidMappingModTime metric in the background, off the
+// request path, unless one has been started within the last kidMappingScanInterval.
+func (source *DirectoryKidMappingSource) scanIfDue() {
+	now := source.clock().Now()
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if !source.lastScan.IsZero() && now.Sub(source.lastScan) < kidMappingScanInterval {
+		return
+	}
+	source.lastScan = now
+	go source.recordOldestModTime()
+}
+
+func (source *DirectoryKidMappingSource) clock() clock.Clock {
+	if source.Clock == nil {
+		return clock.RealClock{}
+	}
+	return source.Clock
+}
+
+// recordOldestModTime scans the directory, updating the oldestKidMappingModTime metric.
+func (source *DirectoryKidMappingSource) recordOldestModTime() {
+	oldest, found, err := oldestKidMappingFileModTime(source.Location)
+	if err != nil {
+		log.Warnf("failed to scan kid mapping directory %s: %s", source.Location, err)
+		return
+	}
+	if found {
+		oldestKidMappingModTime.Set(float64(oldest.Unix()))
+	}
+}
+
+// oldestKidMappingFileModTime returns the modification time of the oldest kid mapping in dir.
+// Files that aren't kid mappings are ignored; see isKidMappingFileName.
+// The returned bool is false if dir contains no kid mappings.
+func oldestKidMappingFileModTime(dir string) (time.Time, bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var oldest time.Time
+	found := false
+	for _, entry := range entries {
+		name := entry.Name()
+		if !isKidMappingFileName(name) {
+			continue
+		}
+		// Stat rather than using entry.Info(), so that symlinks (as used for ConfigMap keys) are followed.
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		if !found || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+			found = true
+		}
+	}
+	return oldest, found, nil
+}
+
+// isKidMappingFileName returns false for the names of files in a kid mapping directory that aren't kid mappings:
+// JWKS, audiences and client certificate files, and the hidden entries Kubernetes creates when mounting a ConfigMap.
+func isKidMappingFileName(name string) bool {
+	return !strings.HasPrefix(name, ".") &&
+		!strings.HasSuffix(name, staticJWKSFileSuffix) &&
+		!strings.HasSuffix(name, kidAudiencesFileSuffix) &&
+		!strings.HasSuffix(name, kidClientCertFileSuffix) &&
+		!strings.HasSuffix(name, kidClientKeyFileSuffix)
+}
+
+// ValidateKidMappings checks every kid mapping maps to a valid https URL, returning an error for each that doesn't,
+// so that all problems can be reported at once. Only directory and file mappings can be enumerated; for other
+// sources, nil is returned.
+func (authService *KubernetesNativeAuthService) ValidateKidMappings() []error {
+	switch source := authService.kidMappingSource().(type) {
+	case *DirectoryKidMappingSource:
+		return validateKidMappingDirectory(source.Location)
+	case *FileKidMappingSource:
+		mappings, err := source.load()
+		if err != nil {
+			return []error{err}
+		}
+		kids := make([]string, 0, len(mappings))
+		for kid := range mappings {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		var errs []error
+		for _, kid := range kids {
+			if err := validateKidMappingURL(mappings[kid]); err != nil {
+				errs = append(errs, fmt.Errorf("invalid mapping for kid %s in %s: %s", kid, source.Path, err))
+			}
+		}
+		return errs
+	default:
+		return nil
+	}
+}
+
+func validateKidMappingDirectory(dir string) []error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if !isKidMappingFileName(name) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := validateKidMappingURL(string(contents)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid mapping for kid %s in %s: %s", name, dir, err))
+		}
+	}
+	return errs
+}
+
+// validateKidMappingURL checks clusterUrl is an absolute https URL.
+func validateKidMappingURL(clusterUrl string) error {
+	parsed, err := url.Parse(strings.TrimSpace(clusterUrl))
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("cluster URL %q is not an https URL", clusterUrl)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("cluster URL %q has no host", clusterUrl)
+	}
+	return nil
+}
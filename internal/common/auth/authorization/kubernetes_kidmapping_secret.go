@@ -0,0 +1,61 @@
+package authorization
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SecretKidMappingSource reads the cluster URLs for all kids from a Kubernetes Secret, whose keys are kids and
+// whose values are the corresponding URLs. The Secret is watched, so changes to it take effect without a restart.
+type SecretKidMappingSource struct {
+	Namespace string
+	Name      string
+
+	lister listers.SecretLister
+	synced cache.InformerSynced
+}
+
+// NewSecretKidMappingSource returns a source watching the Secret namespace/name using client.
+// The watch runs until stop is closed. Lookups fail until the Secret has first been loaded; see WaitForSync.
+func NewSecretKidMappingSource(client kubernetes.Interface, namespace string, name string, stop <-chan struct{}) *SecretKidMappingSource {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	secretInformer := factory.Core().V1().Secrets()
+	source := &SecretKidMappingSource{
+		Namespace: namespace,
+		Name:      name,
+		lister:    secretInformer.Lister(),
+		synced:    secretInformer.Informer().HasSynced,
+	}
+	factory.Start(stop)
+	return source
+}
+
+// WaitForSync blocks until the Secret has been loaded, returning false if stop is closed first.
+func (source *SecretKidMappingSource) WaitForSync(stop <-chan struct{}) bool {
+	return cache.WaitForCacheSync(stop, source.synced)
+}
+
+func (source *SecretKidMappingSource) GetClusterURL(kid string) (string, error) {
+	if !source.synced() {
+		return "", fmt.Errorf("kid mapping secret %s/%s has not been loaded yet", source.Namespace, source.Name)
+	}
+	secret, err := source.lister.Secrets(source.Namespace).Get(source.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get kid mapping secret %s/%s: %s", source.Namespace, source.Name, err)
+	}
+	url, ok := secret.Data[kid]
+	if !ok {
+		return "", fmt.Errorf("%w for kid %s in secret %s/%s", errNoKidMapping, kid, source.Namespace, source.Name)
+	}
+	return string(url), nil
+}
@@ -0,0 +1,65 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretKidMappingSource(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "armada", Name: "kid-mapping"},
+		Data:       map[string][]byte{testKid: []byte(testUrl)},
+	}
+	otherSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "armada", Name: "other"},
+		Data:       map[string][]byte{"other-kid": []byte("https://other")},
+	}
+	client := fake.NewSimpleClientset(secret, otherSecret)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	source := NewSecretKidMappingSource(client, "armada", "kid-mapping", stop)
+	assert.True(t, source.WaitForSync(stop))
+
+	url, err := source.GetClusterURL(testKid)
+	assert.NoError(t, err)
+	assert.Equal(t, testUrl, url)
+
+	_, err = source.GetClusterURL("other-kid")
+	assert.True(t, errors.Is(err, errNoKidMapping))
+
+	// Updates to the secret are picked up.
+	updated := secret.DeepCopy()
+	updated.Data["new-kid"] = []byte("https://new")
+	_, err = client.CoreV1().Secrets("armada").Update(context.Background(), updated, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		url, err := source.GetClusterURL("new-kid")
+		return err == nil && url == "https://new"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAuthenticate_SecretKidMappingSource(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "armada", Name: "kid-mapping"},
+		Data:       map[string][]byte{testKid: []byte(testUrl)},
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	source := NewSecretKidMappingSource(client, "armada", "kid-mapping", stop)
+	assert.True(t, source.WaitForSync(stop))
+
+	authService := createTestAuthService("", true, testName, testTokenIss)
+	authService.KidMappingSource = source
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+}
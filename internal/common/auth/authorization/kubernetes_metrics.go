@@ -0,0 +1,255 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const kubernetesAuthMetricsPrefix = "armada_kubernetes_auth_"
+
+// Possible outcomes of a TokenReview, used to label metrics.
+const (
+	tokenReviewAuthenticated = "authenticated"
+	tokenReviewRejected      = "rejected"
+	tokenReviewError         = "error"
+)
+
+// Component label used for reviews made without a component attached to the context.
+const unknownTokenReviewComponent = "unknown"
+
+var tokenReviewDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    kubernetesAuthMetricsPrefix + "token_review_duration_seconds",
+		Help:    "Time taken to perform a Kubernetes TokenReview",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"component", "outcome"},
+)
+
+var tokenReviewsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "token_reviews_total",
+		Help: "Number of Kubernetes TokenReviews performed, by outcome",
+	},
+	[]string{"component", "outcome"},
+)
+
+var cachedTokenRemainingLifetime = promauto.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    kubernetesAuthMetricsPrefix + "cached_token_remaining_lifetime_seconds",
+		Help:    "Remaining lifetime of valid Kubernetes tokens at the time they're cached",
+		Buckets: []float64{60, 300, 600, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 7 * 24 * 3600},
+	},
+)
+
+var oldestKidMappingModTime = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: kubernetesAuthMetricsPrefix + "oldest_kid_mapping_modified_timestamp_seconds",
+		Help: "Modification time, in seconds since the epoch, of the least recently updated kid mapping",
+	},
+)
+
+var tokenCacheEvictionsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "token_cache_evictions_total",
+		Help: "Number of entries evicted from the Kubernetes token cache, by reason and whether the token was valid",
+	},
+	[]string{"reason", "valid"},
+)
+
+var clusterLimitRejectionsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "cluster_limit_rejections_total",
+		Help: "Number of Kubernetes tokens rejected because their cluster would exceed the limit on distinct clusters",
+	},
+)
+
+var tokenCacheItems = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: kubernetesAuthMetricsPrefix + "token_cache_items",
+		Help: "Number of entries in the Kubernetes token cache, including expired entries not yet removed",
+	},
+)
+
+var tokenCacheEstimatedBytes = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: kubernetesAuthMetricsPrefix + "token_cache_estimated_bytes",
+		Help: "Rough estimate of the memory used by the Kubernetes token cache",
+	},
+)
+
+// Reasons by which authentication failures are counted.
+const (
+	authFailureUnknownKid = "unknown-kid"
+	authFailureExpired    = "expired"
+	authFailureRejected   = "rejected"
+	authFailureInfra      = "infra"
+)
+
+// Maximum number of distinct kids failures are labelled with. Failures for further kids are labelled
+// otherKidLabel. Only kids found in the kid mapping are labelled at all, so this only matters for kid mappings
+// with more entries, or kids with arbitrary parts after KidSeparator.
+const maxAuthFailureKidLabels = 100
+
+const (
+	otherKidLabel = "other"
+	noKidLabel    = "none"
+	// Label of failures for kids not found in the kid mapping, or that failed before they were looked up, so that
+	// tokens with arbitrary kids can neither create unbounded numbers of series nor use up the labels available to
+	// legitimate kids.
+	unknownKidLabel = "unknown"
+)
+
+var authFailuresTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "failures_total",
+		Help: "Number of failed Kubernetes authentications, by token kid and reason",
+	},
+	[]string{"kid", "reason"},
+)
+
+// Kids that failures have been labelled with.
+var authFailureKidLabels = struct {
+	sync.Mutex
+	kids map[string]bool
+}{kids: map[string]bool{}}
+
+// recordAuthFailure counts a failure to authenticate a token with the given kid, which resolved says was found
+// in the kid mapping. Cancelled requests aren't counted.
+func recordAuthFailure(kid string, resolved bool, err error) {
+	reason, ok := authFailureReason(err)
+	if !ok {
+		return
+	}
+	authFailuresTotal.WithLabelValues(authFailureKidLabel(kid, resolved), reason).Inc()
+}
+
+// authFailureReason classifies err for authFailuresTotal. The returned bool is false if err shouldn't be counted.
+func authFailureReason(err error) (string, bool) {
+	var rejected *tokenRejectedError
+	var malformed *malformedTokenError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return "", false
+	case errors.Is(err, errNoKidMapping):
+		return authFailureUnknownKid, true
+	case errors.Is(err, errTokenExpired):
+		return authFailureExpired, true
+	case errors.As(err, &rejected) || errors.As(err, &malformed) || errors.Is(err, errTokenExpiryNotSet):
+		return authFailureRejected, true
+	default:
+		return authFailureInfra, true
+	}
+}
+
+// authFailureKidLabel returns the label authFailuresTotal uses for kid, which resolved says was found in the kid
+// mapping.
+func authFailureKidLabel(kid string, resolved bool) string {
+	if kid == "" {
+		return noKidLabel
+	}
+	if !resolved {
+		return unknownKidLabel
+	}
+	authFailureKidLabels.Lock()
+	defer authFailureKidLabels.Unlock()
+	if authFailureKidLabels.kids[kid] {
+		return kid
+	}
+	if len(authFailureKidLabels.kids) >= maxAuthFailureKidLabels {
+		return otherKidLabel
+	}
+	authFailureKidLabels.kids[kid] = true
+	return kid
+}
+
+var tokenReviewTokenBytes = promauto.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    kubernetesAuthMetricsPrefix + "token_review_token_bytes",
+		Help:    "Length of the tokens sent in Kubernetes TokenReviews",
+		Buckets: prometheus.ExponentialBuckets(256, 2, 8),
+	},
+)
+
+var tokenReviewResponseBytes = promauto.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    kubernetesAuthMetricsPrefix + "token_review_response_bytes",
+		Help:    "Approximate size of Kubernetes TokenReview responses, measured as the encoded size of their status",
+		Buckets: prometheus.ExponentialBuckets(64, 2, 10),
+	},
+)
+
+var tokenCacheCorruptEntriesTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "token_cache_corrupt_entries_total",
+		Help: "Number of entries of an unexpected type found in, and removed from, the Kubernetes token cache",
+	},
+)
+
+type tokenReviewComponentKey struct{}
+
+// WithTokenReviewComponent returns a child context labelling token reviews made with it as originating from
+// the given Armada component, so that a reviewer shared between components can break its metrics down by caller.
+func WithTokenReviewComponent(ctx context.Context, component string) context.Context {
+	return context.WithValue(ctx, tokenReviewComponentKey{}, component)
+}
+
+// TokenReviewComponent returns the component attached to ctx by WithTokenReviewComponent, or "unknown" if none is.
+func TokenReviewComponent(ctx context.Context) string {
+	component, ok := ctx.Value(tokenReviewComponentKey{}).(string)
+	if !ok || component == "" {
+		return unknownTokenReviewComponent
+	}
+	return component
+}
+
+var authPanicsTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: kubernetesAuthMetricsPrefix + "panics_total",
+		Help: "Number of panics recovered from while authenticating Kubernetes tokens",
+	},
+)
+
+// InstrumentedTokenReviewer is a TokenReviewer decorator recording the latency and outcome of every review
+// performed by the wrapped reviewer, so that concrete reviewers can stay free of metrics concerns.
+// Metrics are labelled by the component attached to the request context; see WithTokenReviewComponent.
+type InstrumentedTokenReviewer struct {
+	Reviewer TokenReviewer
+}
+
+func NewInstrumentedTokenReviewer(reviewer TokenReviewer) *InstrumentedTokenReviewer {
+	return &InstrumentedTokenReviewer{Reviewer: reviewer}
+}
+
+func (reviewer *InstrumentedTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	start := time.Now()
+	result, err := reviewer.Reviewer.ReviewToken(ctx, clusterUrl, token, ca)
+
+	component := TokenReviewComponent(ctx)
+	outcome := tokenReviewOutcome(result, err)
+	tokenReviewDuration.WithLabelValues(component, outcome).Observe(time.Since(start).Seconds())
+	tokenReviewsTotal.WithLabelValues(component, outcome).Inc()
+
+	return result, err
+}
+
+// tokenReviewOutcome classifies a review for metrics. API responses refusing the token count as rejections
+// rather than errors, so that clients sending bad tokens don't look like an unhealthy cluster.
+func tokenReviewOutcome(result *authv1.TokenReview, err error) string {
+	if isTokenRejection(err) {
+		return tokenReviewRejected
+	}
+	if err != nil || result == nil {
+		return tokenReviewError
+	}
+	if !result.Status.Authenticated {
+		return tokenReviewRejected
+	}
+	return tokenReviewAuthenticated
+}
@@ -0,0 +1,245 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type CountingTokenReviewer struct {
+	Result *authv1.TokenReview
+	Err    error
+	Calls  int
+}
+
+func (reviewer *CountingTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	reviewer.Calls++
+	return reviewer.Result, reviewer.Err
+}
+
+func histogramSampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	return readHistogram(t, observer).GetSampleCount()
+}
+
+func histogramSampleSum(t *testing.T, observer prometheus.Observer) float64 {
+	return readHistogram(t, observer).GetSampleSum()
+}
+
+func readHistogram(t *testing.T, observer prometheus.Observer) *dto.Histogram {
+	metric := &dto.Metric{}
+	if err := observer.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatalf("failed to read histogram: %s", err)
+	}
+	return metric.GetHistogram()
+}
+
+func TestInstrumentedTokenReviewer(t *testing.T) {
+	tests := map[string]struct {
+		result          *authv1.TokenReview
+		err             error
+		expectedOutcome string
+	}{
+		"authenticated": {
+			result:          &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}},
+			expectedOutcome: tokenReviewAuthenticated,
+		},
+		"rejected": {
+			result:          &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: false}},
+			expectedOutcome: tokenReviewRejected,
+		},
+		"error": {
+			result:          &authv1.TokenReview{},
+			err:             fmt.Errorf("connection refused"),
+			expectedOutcome: tokenReviewError,
+		},
+		"server error": {
+			result:          &authv1.TokenReview{},
+			err:             apierrors.NewInternalError(fmt.Errorf("etcd unavailable")),
+			expectedOutcome: tokenReviewError,
+		},
+		"unauthorized": {
+			result:          &authv1.TokenReview{},
+			err:             apierrors.NewUnauthorized("Unauthorized"),
+			expectedOutcome: tokenReviewRejected,
+		},
+		"forbidden": {
+			result:          &authv1.TokenReview{},
+			err:             apierrors.NewForbidden(schema.GroupResource{}, "", fmt.Errorf("forbidden")),
+			expectedOutcome: tokenReviewRejected,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			wrapped := &CountingTokenReviewer{Result: tc.result, Err: tc.err}
+			reviewer := NewInstrumentedTokenReviewer(wrapped)
+
+			countBefore := testutil.ToFloat64(tokenReviewsTotal.WithLabelValues(unknownTokenReviewComponent, tc.expectedOutcome))
+			samplesBefore := histogramSampleCount(t, tokenReviewDuration.WithLabelValues(unknownTokenReviewComponent, tc.expectedOutcome))
+
+			result, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+
+			assert.Equal(t, tc.result, result)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, 1, wrapped.Calls)
+			assert.Equal(t, countBefore+1, testutil.ToFloat64(tokenReviewsTotal.WithLabelValues(unknownTokenReviewComponent, tc.expectedOutcome)))
+			assert.Equal(t, samplesBefore+1, histogramSampleCount(t, tokenReviewDuration.WithLabelValues(unknownTokenReviewComponent, tc.expectedOutcome)))
+		})
+	}
+}
+
+func TestInstrumentedTokenReviewer_ComponentLabel(t *testing.T) {
+	wrapped := &CountingTokenReviewer{Result: &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}}
+	reviewer := NewInstrumentedTokenReviewer(wrapped)
+	ctx := WithTokenReviewComponent(context.Background(), "executor-api")
+
+	countBefore := testutil.ToFloat64(tokenReviewsTotal.WithLabelValues("executor-api", tokenReviewAuthenticated))
+	unknownBefore := testutil.ToFloat64(tokenReviewsTotal.WithLabelValues(unknownTokenReviewComponent, tokenReviewAuthenticated))
+
+	_, err := reviewer.ReviewToken(ctx, testUrl, testToken, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, countBefore+1, testutil.ToFloat64(tokenReviewsTotal.WithLabelValues("executor-api", tokenReviewAuthenticated)))
+	assert.Equal(t, unknownBefore, testutil.ToFloat64(tokenReviewsTotal.WithLabelValues(unknownTokenReviewComponent, tokenReviewAuthenticated)))
+}
+
+func TestCachedTokenRemainingLifetime(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	samplesBefore := histogramSampleCount(t, cachedTokenRemainingLifetime)
+	sumBefore := histogramSampleSum(t, cachedTokenRemainingLifetime)
+
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, samplesBefore+1, histogramSampleCount(t, cachedTokenRemainingLifetime))
+	assert.Equal(t, sumBefore+float64(testTokenExp-testTokenIss), histogramSampleSum(t, cachedTokenRemainingLifetime))
+
+	// Cache hits and rejected tokens aren't observed.
+	_, err = authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	rejectingService := createTestAuthService(createKidMappingDir(t), false, testName, testTokenIss)
+	_, err = rejectingService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.Equal(t, samplesBefore+1, histogramSampleCount(t, cachedTokenRemainingLifetime))
+}
+
+func TestAuthFailuresTotal(t *testing.T) {
+	const unmappedKid = "unmapped-kid"
+	unmappedToken := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, unmappedKid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+	tests := map[string]struct {
+		token         string
+		authenticated bool
+		currentTime   int64
+		reviewErr     error
+		expectedKid   string
+		expectedLabel string
+	}{
+		"rejected": {
+			token:         testToken,
+			currentTime:   testTokenIss,
+			expectedKid:   testKid,
+			expectedLabel: authFailureRejected,
+		},
+		// Expiry is checked before the kid is looked up, so even mapped kids aren't known to be.
+		"expired": {
+			token:         testToken,
+			authenticated: true,
+			currentTime:   testTokenExp + 1,
+			expectedKid:   unknownKidLabel,
+			expectedLabel: authFailureExpired,
+		},
+		"unknown kid": {
+			token:         unmappedToken,
+			authenticated: true,
+			currentTime:   testTokenIss,
+			expectedKid:   unknownKidLabel,
+			expectedLabel: authFailureUnknownKid,
+		},
+		"expired unknown kid": {
+			token:         unmappedToken,
+			authenticated: true,
+			currentTime:   testTokenExp + 1,
+			expectedKid:   unknownKidLabel,
+			expectedLabel: authFailureExpired,
+		},
+		"infra": {
+			token:         testToken,
+			currentTime:   testTokenIss,
+			reviewErr:     fmt.Errorf("connection refused"),
+			expectedKid:   testKid,
+			expectedLabel: authFailureInfra,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), tc.authenticated, testName, tc.currentTime)
+			if tc.reviewErr != nil {
+				authService.TokenReviewer = &CountingTokenReviewer{Err: tc.reviewErr}
+			}
+			counter := authFailuresTotal.WithLabelValues(tc.expectedKid, tc.expectedLabel)
+			before := testutil.ToFloat64(counter)
+
+			_, err := authService.Authenticate(createAuthContext(tc.token))
+			assert.Error(t, err)
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
+
+// CountingKidMappingSource counts lookups made of the wrapped source.
+type CountingKidMappingSource struct {
+	Source  KidMappingSource
+	Lookups int
+}
+
+func (source *CountingKidMappingSource) GetClusterURL(kid string) (string, error) {
+	source.Lookups++
+	return source.Source.GetClusterURL(kid)
+}
+
+func TestAuthFailuresTotal_CachedRejectionsNotLookedUp(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), false, testName, testTokenIss)
+	authService.SetInvalidTokenExpiry(time.Minute)
+	source := &CountingKidMappingSource{Source: NewDirectoryKidMappingSource(authService.KidMappingFileLocation)}
+	authService.KidMappingSource = source
+	counter := authFailuresTotal.WithLabelValues(testKid, authFailureRejected)
+	before := testutil.ToFloat64(counter)
+
+	for i := 0; i < 3; i++ {
+		_, err := authService.Authenticate(createAuthContext(testToken))
+		assert.Error(t, err)
+	}
+	// Only the first attempt, which was reviewed, looked the kid up; the others were served from the cache
+	// but are still labelled with the kid.
+	assert.Equal(t, 1, source.Lookups)
+	assert.Equal(t, before+3, testutil.ToFloat64(counter))
+}
+
+func TestAuthFailureKidLabel_BoundsCardinality(t *testing.T) {
+	authFailureKidLabels.Lock()
+	saved := authFailureKidLabels.kids
+	authFailureKidLabels.kids = map[string]bool{}
+	authFailureKidLabels.Unlock()
+	defer func() {
+		authFailureKidLabels.Lock()
+		authFailureKidLabels.kids = saved
+		authFailureKidLabels.Unlock()
+	}()
+
+	// Unmapped kids don't use up labels.
+	assert.Equal(t, unknownKidLabel, authFailureKidLabel("junk", false))
+	for i := 0; i < maxAuthFailureKidLabels; i++ {
+		kid := fmt.Sprintf("kid-%d", i)
+		assert.Equal(t, kid, authFailureKidLabel(kid, true))
+	}
+	assert.Equal(t, otherKidLabel, authFailureKidLabel("one-too-many", true))
+	assert.Equal(t, "kid-0", authFailureKidLabel("kid-0", true))
+	assert.Equal(t, noKidLabel, authFailureKidLabel("", false))
+}
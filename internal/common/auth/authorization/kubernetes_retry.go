@@ -0,0 +1,84 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// RetryingTokenReviewer is a TokenReviewer decorator that retries reviews failing because of an infrastructure
+// problem (a 5xx or 429 response, or a network error), up to MaxAttempts attempts in total, waiting Backoff before
+// the first retry and doubling the wait before each subsequent one. Other errors, such as the 4xx responses given
+// to invalid tokens, and cancelled requests are returned immediately. Rejected tokens are not errors, so are never
+// retried either. Once attempts are exhausted, a *TokenReviewError is returned, marking the failure as temporary.
+type RetryingTokenReviewer struct {
+	Reviewer    TokenReviewer
+	MaxAttempts int
+	Backoff     time.Duration
+	Clock       clock.Clock
+}
+
+func NewRetryingTokenReviewer(reviewer TokenReviewer, maxAttempts int, backoff time.Duration, clock clock.Clock) *RetryingTokenReviewer {
+	return &RetryingTokenReviewer{
+		Reviewer:    reviewer,
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		Clock:       clock,
+	}
+}
+
+func (reviewer *RetryingTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	backoff := reviewer.Backoff
+	attempts := 0
+	for {
+		attempts++
+		result, err := reviewer.Reviewer.ReviewToken(ctx, clusterUrl, token, ca)
+		if !isInfrastructureFailure(ctx, err) {
+			return result, err
+		}
+		if attempts >= reviewer.MaxAttempts {
+			return nil, &TokenReviewError{Attempts: attempts, RetryAfter: backoff, Err: err}
+		}
+		if backoff > 0 {
+			select {
+			case <-reviewer.Clock.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		backoff *= 2
+	}
+}
+
+// TokenReviewError is returned when a TokenReview fails with an error on every attempt, e.g. because the
+// cluster is unreachable. Such failures are temporary: unlike rejections, the same request may succeed later.
+type TokenReviewError struct {
+	// Number of attempts made.
+	Attempts int
+	// How long the next attempt would have waited. Callers retrying at a higher level should wait at least this long.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (err *TokenReviewError) Error() string {
+	return fmt.Sprintf("token review failed after %d attempts: %s", err.Attempts, err.Err)
+}
+
+func (err *TokenReviewError) Unwrap() error {
+	return err.Err
+}
+
+func (err *TokenReviewError) Temporary() bool {
+	return true
+}
+
+// IsTemporary returns true if err, or any error it wraps, reports itself as temporary, meaning the request
+// failed because of a transient infrastructure problem rather than being rejected, and may be retried.
+func IsTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
@@ -0,0 +1,138 @@
+package authorization
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	authv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// flakyTokenReviewer fails the first Failures reviews with an error, then authenticates every token.
+type flakyTokenReviewer struct {
+	Failures int
+	Calls    int
+}
+
+func (reviewer *flakyTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	reviewer.Calls++
+	if reviewer.Calls <= reviewer.Failures {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true, User: authv1.UserInfo{Username: testName}}}, nil
+}
+
+func TestRetryingTokenReviewer_SucceedsAfterRetries(t *testing.T) {
+	wrapped := &flakyTokenReviewer{Failures: 2}
+	reviewer := NewRetryingTokenReviewer(wrapped, 3, 0, clock.RealClock{})
+
+	result, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.NoError(t, err)
+	assert.True(t, result.Status.Authenticated)
+	assert.Equal(t, 3, wrapped.Calls)
+}
+
+func TestRetryingTokenReviewer_ExhaustedRetries(t *testing.T) {
+	wrapped := &flakyTokenReviewer{Failures: 5}
+	reviewer := NewRetryingTokenReviewer(wrapped, 3, time.Millisecond, clock.RealClock{})
+
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	var reviewErr *TokenReviewError
+	if assert.True(t, errors.As(err, &reviewErr)) {
+		assert.Equal(t, 3, reviewErr.Attempts)
+		assert.Equal(t, 4*time.Millisecond, reviewErr.RetryAfter)
+	}
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 3, wrapped.Calls)
+}
+
+func TestRetryingTokenReviewer_DoesNotRetryCancelledRequests(t *testing.T) {
+	wrapped := &CountingTokenReviewer{Err: context.Canceled}
+	reviewer := NewRetryingTokenReviewer(wrapped, 3, 0, clock.RealClock{})
+
+	_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, IsTemporary(err))
+	assert.Equal(t, 1, wrapped.Calls)
+}
+
+func TestRetryingTokenReviewer_RetriesOnlyInfrastructureFailures(t *testing.T) {
+	tests := map[string]struct {
+		err           error
+		expectRetries bool
+	}{
+		"network error":         {err: fmt.Errorf("dial tcp: connection refused"), expectRetries: true},
+		"internal server error": {err: apierrors.NewInternalError(fmt.Errorf("etcd unavailable")), expectRetries: true},
+		"too many requests":     {err: apierrors.NewTooManyRequests("slow down", 1), expectRetries: true},
+		"unauthorized":          {err: apierrors.NewUnauthorized("Unauthorized")},
+		"forbidden":             {err: apierrors.NewForbidden(schema.GroupResource{}, "", fmt.Errorf("forbidden"))},
+		"bad request":           {err: apierrors.NewBadRequest("bad request")},
+		"unknown CA":            {err: &url.Error{Op: "Post", URL: testUrl, Err: x509.UnknownAuthorityError{}}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			wrapped := &CountingTokenReviewer{Err: tc.err}
+			reviewer := NewRetryingTokenReviewer(wrapped, 3, 0, clock.RealClock{})
+
+			_, err := reviewer.ReviewToken(context.Background(), testUrl, testToken, nil)
+			assert.ErrorIs(t, err, tc.err)
+			if tc.expectRetries {
+				assert.Equal(t, 3, wrapped.Calls)
+				assert.True(t, IsTemporary(err))
+			} else {
+				assert.Equal(t, 1, wrapped.Calls)
+				assert.False(t, IsTemporary(err))
+			}
+		})
+	}
+}
+
+func TestAuthenticate_RefusedTokenNotRetried(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	wrapped := &CountingTokenReviewer{Err: apierrors.NewUnauthorized("Unauthorized")}
+	authService.TokenReviewer = NewRetryingTokenReviewer(wrapped, 3, 0, clock.RealClock{})
+
+	_, err := authService.AuthenticateGRPC(createAuthContext(testToken))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 1, wrapped.Calls)
+}
+
+func TestAuthenticate_ReportsTemporaryFailures(t *testing.T) {
+	tests := map[string]struct {
+		reviewer          TokenReviewer
+		expectedTemporary bool
+		expectedCode      codes.Code
+	}{
+		"exhausted retries": {
+			reviewer:          NewRetryingTokenReviewer(&flakyTokenReviewer{Failures: 5}, 2, 0, clock.RealClock{}),
+			expectedTemporary: true,
+			expectedCode:      codes.Unavailable,
+		},
+		"rejected": {
+			reviewer:          NewRetryingTokenReviewer(&MockTokenReviewer{Authenticated: false}, 2, 0, clock.RealClock{}),
+			expectedTemporary: false,
+			expectedCode:      codes.Unauthenticated,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.TokenReviewer = tc.reviewer
+
+			_, err := authService.Authenticate(createAuthContext(testToken))
+			assert.Error(t, err)
+			assert.Equal(t, tc.expectedTemporary, IsTemporary(err))
+			assert.Equal(t, tc.expectedCode, status.Code(grpcStatusError(err)))
+		})
+	}
+}
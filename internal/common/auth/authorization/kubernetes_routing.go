@@ -0,0 +1,50 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+// RoutingTokenReviewer is a TokenReviewer that delegates each review to the reviewer registered for the longest
+// prefix of the token's kid, so that in a federation different clusters can be reviewed in different ways,
+// e.g. some in-cluster and others remotely. Tokens whose kid matches no prefix go to Default, or are rejected
+// if it's nil. Prefixes are matched against the kid as it appears in the token, before any KidPrefix is stripped.
+type RoutingTokenReviewer struct {
+	Routes  map[string]TokenReviewer
+	Default TokenReviewer
+}
+
+func NewRoutingTokenReviewer(routes map[string]TokenReviewer, defaultReviewer TokenReviewer) *RoutingTokenReviewer {
+	return &RoutingTokenReviewer{
+		Routes:  routes,
+		Default: defaultReviewer,
+	}
+}
+
+func (reviewer *RoutingTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	kid, err := parseKid(token)
+	if err != nil {
+		return nil, err
+	}
+	route := reviewer.route(kid)
+	if route == nil {
+		return nil, &tokenRejectedError{fmt.Sprintf("no token reviewer for kid %s", kid)}
+	}
+	return route.ReviewToken(ctx, clusterUrl, token, ca)
+}
+
+// route returns the reviewer for kid, or nil if there's none.
+func (reviewer *RoutingTokenReviewer) route(kid string) TokenReviewer {
+	longest := -1
+	route := reviewer.Default
+	for prefix, candidate := range reviewer.Routes {
+		if len(prefix) > longest && strings.HasPrefix(kid, prefix) {
+			longest = len(prefix)
+			route = candidate
+		}
+	}
+	return route
+}
@@ -0,0 +1,71 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func TestRoutingTokenReviewer(t *testing.T) {
+	authenticated := &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: true}}
+	tokenWithKid := func(kid string) string {
+		return createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, kid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+	}
+	tests := map[string]struct {
+		kid             string
+		withoutDefault  bool
+		expectedReviews []int
+		expectError     bool
+	}{
+		"first prefix": {
+			kid:             "local-cluster-a",
+			expectedReviews: []int{1, 0, 0, 0},
+		},
+		"second prefix": {
+			kid:             "remote-cluster-b",
+			expectedReviews: []int{0, 1, 0, 0},
+		},
+		"longest prefix wins": {
+			kid:             "remote-eu-cluster-c",
+			expectedReviews: []int{0, 0, 1, 0},
+		},
+		"default": {
+			kid:             "other-cluster",
+			expectedReviews: []int{0, 0, 0, 1},
+		},
+		"no route": {
+			kid:             "other-cluster",
+			withoutDefault:  true,
+			expectedReviews: []int{0, 0, 0, 0},
+			expectError:     true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			local := &CountingTokenReviewer{Result: authenticated}
+			remote := &CountingTokenReviewer{Result: authenticated}
+			remoteEU := &CountingTokenReviewer{Result: authenticated}
+			fallback := &CountingTokenReviewer{Result: authenticated}
+			reviewer := NewRoutingTokenReviewer(map[string]TokenReviewer{
+				"local-":     local,
+				"remote-":    remote,
+				"remote-eu-": remoteEU,
+			}, fallback)
+			if tc.withoutDefault {
+				reviewer.Default = nil
+			}
+
+			result, err := reviewer.ReviewToken(context.Background(), testUrl, tokenWithKid(tc.kid), nil)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, authenticated, result)
+			}
+			assert.Equal(t, tc.expectedReviews, []int{local.Calls, remote.Calls, remoteEU.Calls, fallback.Calls})
+		})
+	}
+}
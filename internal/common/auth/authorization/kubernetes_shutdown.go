@@ -0,0 +1,84 @@
+package authorization
+
+import (
+	"context"
+	"sync"
+)
+
+// errReviewsStopped is returned for reviews attempted after Stop. It's temporary, so that clients retry
+// against another replica rather than treating their token as rejected.
+var errReviewsStopped = &reviewsStoppedError{}
+
+type reviewsStoppedError struct{}
+
+func (err *reviewsStoppedError) Error() string {
+	return "kubernetes auth service is shutting down"
+}
+
+func (err *reviewsStoppedError) Temporary() bool {
+	return true
+}
+
+// reviewShutdown cancels in-flight TokenReviews when the service is stopped, and lets Stop wait for them
+// to return. A nil *reviewShutdown never cancels anything.
+type reviewShutdown struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex    sync.Mutex
+	stopped  bool
+	inFlight sync.WaitGroup
+}
+
+func newReviewShutdown() *reviewShutdown {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &reviewShutdown{ctx: ctx, cancel: cancel}
+}
+
+// begin returns a child of ctx that's also cancelled by stop, and a function that must be called once the
+// review made with it has returned. It returns errReviewsStopped if stop has already been called.
+func (shutdown *reviewShutdown) begin(ctx context.Context) (context.Context, func(), error) {
+	if shutdown == nil {
+		return ctx, func() {}, nil
+	}
+	shutdown.mutex.Lock()
+	defer shutdown.mutex.Unlock()
+	if shutdown.stopped {
+		return nil, nil, errReviewsStopped
+	}
+	shutdown.inFlight.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-shutdown.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		shutdown.inFlight.Done()
+	}, nil
+}
+
+// stop cancels in-flight reviews and waits for them to return. Later reviews fail with errReviewsStopped.
+func (shutdown *reviewShutdown) stop() {
+	if shutdown == nil {
+		return
+	}
+	shutdown.mutex.Lock()
+	shutdown.stopped = true
+	shutdown.cancel()
+	shutdown.mutex.Unlock()
+	shutdown.inFlight.Wait()
+}
+
+// Stop cancels any TokenReviews in progress, including coalesced and retried reviews no longer tied to a
+// caller's context, and waits for them to return. Subsequent reviews fail with a temporary error; tokens
+// already cached continue to be accepted. Any token cache sampler is also stopped. It's safe to call more
+// than once.
+func (authService *KubernetesNativeAuthService) Stop() {
+	authService.tokenCacheSampler.Stop()
+	authService.shutdown.stop()
+}
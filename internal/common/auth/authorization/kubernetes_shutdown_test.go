@@ -0,0 +1,55 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStop_CancelsInFlightReviews(t *testing.T) {
+	reviewer := &BlockingTokenReviewer{started: make(chan struct{}), release: make(chan struct{})}
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = reviewer
+	// Coalesced reviews are detached from the caller's context, so only Stop can cancel them.
+	authService.ReviewGroup = &singleflight.Group{}
+	authService.shutdown = newReviewShutdown()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := authService.AuthenticateGRPC(createAuthContext(testToken))
+		errs <- err
+	}()
+	<-reviewer.started
+
+	stopped := make(chan struct{})
+	go func() {
+		authService.Stop()
+		close(stopped)
+	}()
+	select {
+	case err := <-errs:
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("review was not cancelled by Stop")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	_, err := authService.AuthenticateGRPC(createAuthContext(testToken))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	authService.Stop()
+}
+
+func TestStop_WithoutShutdown(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.Stop()
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+}
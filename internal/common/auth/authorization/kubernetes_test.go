@@ -1,20 +1,35 @@
 package authorization
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
 	authv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/clock"
 
 	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/G-Research/armada/internal/common/auth/configuration"
 )
@@ -51,16 +66,151 @@ func TestValidateKid(t *testing.T) {
 	assert.NoError(t, validateKid(testKid))
 }
 
-func TestParseTime(t *testing.T) {
-	myTime, err := parseTime(testToken)
+func TestParseClaims_Expiry(t *testing.T) {
+	claims, err := parseClaims(testToken)
 	assert.NoError(t, err)
-	assert.Equal(t, time.Unix(testTokenExp, 0), myTime)
+	assert.Equal(t, time.Unix(testTokenExp, 0), claims.Expiry)
 }
 
-func TestParseTime_FailsWhenNoExpiry(t *testing.T) {
-	myTime, err := parseTime(testTokenNoExp)
+func TestParseClaims_NoExpiry(t *testing.T) {
+	claims, err := parseClaims(testTokenNoExp)
+	assert.NoError(t, err)
+	assert.True(t, claims.Expiry.IsZero())
+}
+
+func TestEncodeKubernetesAuthHeader(t *testing.T) {
+	tests := map[string]struct {
+		token string
+		ca    []byte
+	}{
+		"token and ca":       {token: testToken, ca: []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")},
+		"no ca":              {token: testToken},
+		"special characters": {token: `tok"en\`, ca: []byte{0xff, 0xfe, '"'}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			token, ca, err := parseAuth(EncodeKubernetesAuthHeader(tc.token, tc.ca))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.token, token)
+			assert.Equal(t, string(tc.ca), ca)
+		})
+	}
+}
+
+func TestDecodeKubernetesAuthHeader(t *testing.T) {
+	ca := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+	token, decodedCa, err := DecodeKubernetesAuthHeader(createKubernetesAuthPayload(testToken, ca))
+	assert.NoError(t, err)
+	assert.Equal(t, testToken, token)
+	assert.Equal(t, ca, decodedCa)
+
+	token, decodedCa, err = DecodeKubernetesAuthHeader(encodeAuthBody(testToken, []byte(ca)))
+	assert.NoError(t, err)
+	assert.Equal(t, testToken, token)
+	assert.Equal(t, ca, decodedCa)
+}
+
+func TestDecodeKubernetesAuthHeader_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"wrong scheme":  "Bearer " + encodeAuthBody(testToken, nil),
+		"not base64":    "KubernetesAuth !!!",
+		"not json":      "KubernetesAuth " + base64.RawURLEncoding.EncodeToString([]byte("token")),
+		"empty token":   createKubernetesAuthPayload("", testCA),
+		"token not jwt": createKubernetesAuthPayload("token", testCA),
+		"empty":         "",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := DecodeKubernetesAuthHeader(value)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCheckPlausibleJWT(t *testing.T) {
+	assert.NoError(t, checkPlausibleJWT(testToken))
+	assert.NoError(t, checkPlausibleJWT(testTokenNoExp))
+	for name, token := range map[string]string{
+		"empty":         "",
+		"too short":     "a.b.c",
+		"two parts":     "abcdefghij.klmnopqrst",
+		"four parts":    "abcde.fghij.klmno.pqrst",
+		"empty header":  ".abcdefghij.klmnopqrst",
+		"empty payload": "abcdefghij..klmnopqrst",
+		"no separators": strings.Repeat("a", 100),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, checkPlausibleJWT(token))
+		})
+	}
+}
+
+func TestParseAuth_TooShort(t *testing.T) {
+	_, _, err := parseAuth("eyJ0b2tlbiI6IiJ9")
+	assert.Error(t, err)
+}
+
+func TestAuthenticate_RejectsImplausibleTokens(t *testing.T) {
+	for name, value := range map[string]string{
+		"too short credentials": "KubernetesAuth eyJ0b2tlbiI6IiJ9",
+		"too short token":       createKubernetesAuthPayload("a.b.c", testCA),
+		"non-three-part token":  createKubernetesAuthPayload("abcdefghij.klmnopqrst", testCA),
+	} {
+		t.Run(name, func(t *testing.T) {
+			reviewer := &CountingTokenReviewer{}
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.TokenReviewer = reviewer
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", value))
+
+			_, err := authService.AuthenticateGRPC(ctx)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Equal(t, 0, reviewer.Calls)
+		})
+	}
+}
+
+func TestParseAuth_GzippedCA(t *testing.T) {
+	ca := "-----BEGIN CERTIFICATE-----\nMIIBszCCAVmgAwIBAgIUFakeCertificateData\n-----END CERTIFICATE-----\n"
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(ca))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	plainToken, plainCa, err := parseAuth(encodeAuthBody(testToken, []byte(ca)))
+	assert.NoError(t, err)
+
+	gzippedToken, gzippedCa, err := parseAuth(encodeAuthBody(testToken, compressed.Bytes()))
+	assert.NoError(t, err)
+
+	assert.Equal(t, ca, plainCa)
+	assert.Equal(t, plainCa, gzippedCa)
+	assert.Equal(t, plainToken, gzippedToken)
+}
+
+func TestParseAuth_CorruptGzippedCA(t *testing.T) {
+	_, _, err := parseAuth(encodeAuthBody(testToken, []byte{0x1f, 0x8b, 0x00, 0x01}))
+	assert.Error(t, err)
+}
+
+func TestParseAuth_OversizedGzippedCA(t *testing.T) {
+	compress := func(size int) []byte {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		_, err := writer.Write(make([]byte, size))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+		return compressed.Bytes()
+	}
+
+	_, ca, err := parseAuth(encodeAuthBody(testToken, compress(maxDecompressedCASize)))
+	assert.NoError(t, err)
+	assert.Len(t, ca, maxDecompressedCASize)
+
+	_, _, err = parseAuth(encodeAuthBody(testToken, compress(maxDecompressedCASize+1)))
 	assert.Error(t, err)
-	assert.Equal(t, time.Time{}, myTime)
 }
 
 func TestGetClusterURL(t *testing.T) {
@@ -91,9 +241,435 @@ func TestGetClusterURL(t *testing.T) {
 	assert.Equal(t, testUrl, url)
 }
 
+// createTestJWT returns an unsigned JWT with the given header and payload.
+func createTestJWT(header string, payload string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestGetClusterURL_KidPrefix(t *testing.T) {
+	tests := map[string]struct {
+		kid         string
+		kidPrefix   string
+		expectError bool
+	}{
+		"prefixed kid": {
+			kid:       "issuer-" + testKid,
+			kidPrefix: "issuer-",
+		},
+		"unprefixed kid with prefix configured": {
+			kid:         testKid,
+			kidPrefix:   "issuer-",
+			expectError: true,
+		},
+		"unprefixed kid without prefix configured": {
+			kid: testKid,
+		},
+		"traversal after prefix": {
+			kid:         "issuer-../" + testKid,
+			kidPrefix:   "issuer-",
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.KidPrefix = tc.kidPrefix
+			token := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, tc.kid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+
+			url, err := authService.getClusterURL(token)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testUrl, url)
+			}
+		})
+	}
+}
+
+func TestGetClusterURL_KidSeparator(t *testing.T) {
+	tests := map[string]struct {
+		kid          string
+		kidPrefix    string
+		kidSeparator string
+		expectError  bool
+	}{
+		"composite kid": {
+			kid:          testKid + "/keyid",
+			kidSeparator: "/",
+		},
+		"composite kid with multiple separators": {
+			kid:          testKid + "/keyid/extra",
+			kidSeparator: "/",
+		},
+		"simple kid with separator configured": {
+			kid:          testKid,
+			kidSeparator: "/",
+		},
+		"composite kid with prefix": {
+			kid:          "issuer-" + testKid + "#keyid",
+			kidPrefix:    "issuer-",
+			kidSeparator: "#",
+		},
+		"composite kid without separator configured": {
+			kid:         testKid + "/keyid",
+			expectError: true,
+		},
+		"empty cluster part": {
+			kid:          "/keyid",
+			kidSeparator: "/",
+			expectError:  true,
+		},
+		"traversal in cluster part": {
+			kid:          "../" + testKid + "/keyid",
+			kidSeparator: "/",
+			expectError:  true,
+		},
+		"parent directory as cluster part": {
+			kid:          "..#keyid",
+			kidSeparator: "#",
+			expectError:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.KidPrefix = tc.kidPrefix
+			authService.KidSeparator = tc.kidSeparator
+			token := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, tc.kid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+
+			url, err := authService.getClusterURL(token)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testUrl, url)
+			}
+		})
+	}
+}
+
+func TestGetClusterURL_DefaultClusterURL(t *testing.T) {
+	tests := map[string]struct {
+		kid                   string
+		allowTokensWithoutKid bool
+		defaultClusterURL     string
+		expectedUrl           string
+		expectError           bool
+	}{
+		"empty kid with default": {
+			allowTokensWithoutKid: true,
+			defaultClusterURL:     "https://default.cluster",
+			expectedUrl:           "https://default.cluster",
+		},
+		"empty kid without default": {
+			allowTokensWithoutKid: true,
+			expectError:           true,
+		},
+		"empty kid with default but not allowed": {
+			defaultClusterURL: "https://default.cluster",
+			expectError:       true,
+		},
+		"kid with default": {
+			kid:                   testKid,
+			allowTokensWithoutKid: true,
+			defaultClusterURL:     "https://default.cluster",
+			expectedUrl:           testUrl,
+		},
+		"unmapped kid with default": {
+			kid:                   "unmapped",
+			allowTokensWithoutKid: true,
+			defaultClusterURL:     "https://default.cluster",
+			expectError:           true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.AllowTokensWithoutKid = tc.allowTokensWithoutKid
+			authService.DefaultClusterURL = tc.defaultClusterURL
+			header := `{"alg":"RS256"}`
+			if tc.kid != "" {
+				header = fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, tc.kid)
+			}
+			token := createTestJWT(header, fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+
+			url, err := authService.getClusterURL(token)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedUrl, url)
+			}
+		})
+	}
+}
+
+func TestParseKid_MalformedHeader(t *testing.T) {
+	tests := map[string]string{
+		"not json":        createTestJWT("not json", fmt.Sprintf(`{"exp":%d}`, testTokenExp)),
+		"json not object": createTestJWT(`["kid"]`, fmt.Sprintf(`{"exp":%d}`, testTokenExp)),
+		"not base64":      "!!!." + strings.Split(testToken, ".")[1] + ".c2lnbmF0dXJl",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseKid(token)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "malformed token header")
+			}
+		})
+	}
+}
+
+func TestAuthenticate_StrictTokenHeader(t *testing.T) {
+	payload := fmt.Sprintf(`{"exp":%d}`, testTokenExp)
+	tests := map[string]struct {
+		header      string
+		strict      bool
+		expectError bool
+	}{
+		"lenient with extra field": {
+			header: fmt.Sprintf(`{"alg":"RS256","kid":"%s","extra":"field"}`, testKid),
+		},
+		"strict with standard fields": {
+			header: fmt.Sprintf(`{"alg":"RS256","kid":"%s","typ":"JWT"}`, testKid),
+			strict: true,
+		},
+		"strict with extra field": {
+			header:      fmt.Sprintf(`{"alg":"RS256","kid":"%s","extra":"field"}`, testKid),
+			strict:      true,
+			expectError: true,
+		},
+		"strict with mistyped field": {
+			header:      fmt.Sprintf(`{"alg":"RS256","kid":"%s","crit":"exp"}`, testKid),
+			strict:      true,
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.StrictTokenHeader = tc.strict
+
+			_, err := authService.Authenticate(createAuthContext(createTestJWT(tc.header, payload)))
+			if tc.expectError {
+				assert.Equal(t, codes.InvalidArgument, status.Code(grpcStatusError(err)))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_AllowedTokenTypes(t *testing.T) {
+	payload := fmt.Sprintf(`{"exp":%d}`, testTokenExp)
+	tests := map[string]struct {
+		typ          string
+		allowedTypes []string
+		expectError  bool
+	}{
+		"JWT typ enforced":            {typ: "JWT", allowedTypes: []string{"JWT"}},
+		"JWT typ differently cased":   {typ: "jwt", allowedTypes: []string{"JWT"}},
+		"unexpected typ enforced":     {typ: "at+jwt", allowedTypes: []string{"JWT"}, expectError: true},
+		"unexpected typ not enforced": {typ: "at+jwt"},
+		"missing typ enforced":        {allowedTypes: []string{"JWT"}},
+		"one of several allowed typs": {typ: "at+jwt", allowedTypes: []string{"JWT", "at+jwt"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.AllowedTokenTypes = tc.allowedTypes
+			header := fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid)
+			if tc.typ != "" {
+				header = fmt.Sprintf(`{"alg":"RS256","kid":"%s","typ":"%s"}`, testKid, tc.typ)
+			}
+
+			_, err := authService.Authenticate(createAuthContext(createTestJWT(header, payload)))
+			if tc.expectError {
+				assert.Equal(t, codes.Unauthenticated, status.Code(grpcStatusError(err)))
+				assert.ErrorContains(t, err, "token type")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseStdEncodedSegments(t *testing.T) {
+	// The "???>>>" values force '+' and '/' into the standard base64 encoding.
+	header := base64.StdEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"` + testKid + `","x":"???>>>"}`))
+	payload := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d,"x":"???>>>?"}`, testTokenExp)))
+	assert.True(t, strings.ContainsAny(header, "+/"))
+	assert.True(t, strings.ContainsAny(payload, "+/="))
+	token := header + "." + payload + ".c2lnbmF0dXJl"
+
+	kid, err := parseKid(token)
+	assert.NoError(t, err)
+	assert.Equal(t, testKid, kid)
+
+	claims, err := parseClaims(token)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(testTokenExp, 0), claims.Expiry)
+
+	testAuthService := NewKubernetesNativeAuthService(configuration.KubernetesAuthConfig{
+		KidMappingFileLocation: createKidMappingDir(t),
+	})
+	url, err := testAuthService.getClusterURL(token)
+	assert.NoError(t, err)
+	assert.Equal(t, testUrl, url)
+}
+
+func TestAuthenticate_KidValidator(t *testing.T) {
+	kidPattern := regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+	validator := func(kid string) error {
+		if !kidPattern.MatchString(kid) {
+			return fmt.Errorf("kid doesn't match %s", kidPattern)
+		}
+		return nil
+	}
+	kidMappingDir := createKidMappingDir(t)
+	authService := NewKubernetesNativeAuthService(
+		configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingDir},
+		WithKidValidator(validator))
+	authService.TokenReviewer = &MockTokenReviewer{Authenticated: true, Username: testName}
+	authService.Clock = clock.NewFakeClock(time.Unix(testTokenIss, 0))
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	// Accepted by the default validator, but not the custom one.
+	disallowedKid := "short-kid"
+	assert.NoError(t, validateKid(disallowedKid))
+	assert.NoError(t, os.WriteFile(filepath.Join(kidMappingDir, disallowedKid), []byte(testUrl), 0o644))
+	token := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, disallowedKid), fmt.Sprintf(`{"exp":%d}`, testTokenExp))
+	_, err = authService.Authenticate(createAuthContext(token))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "kid doesn't match")
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	cause := fmt.Errorf("Post \"https://cluster/apis?token=%s\": dial tcp: connection refused", testToken)
+	wrapped := fmt.Errorf("token review failed: %w", cause)
+
+	redacted := RedactToken(wrapped, testToken)
+	assert.NotContains(t, redacted.Error(), testToken)
+	assert.Contains(t, redacted.Error(), "token=[REDACTED]")
+	assert.ErrorIs(t, redacted, cause)
+
+	unrelated := fmt.Errorf("connection refused")
+	assert.Equal(t, unrelated, RedactToken(unrelated, testToken))
+	assert.Nil(t, RedactToken(nil, testToken))
+}
+
+func TestAuthenticate_RedactsReviewerErrors(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = &CountingTokenReviewer{Err: fmt.Errorf("request with bearer %s failed", testToken)}
+
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), testToken)
+}
+
+func TestNewKubernetesNativeAuthServiceWithError(t *testing.T) {
+	kidMappingDir := createKidMappingDir(t)
+	kidMappingFile := filepath.Join(kidMappingDir, testKid)
+	tests := map[string]struct {
+		config      configuration.KubernetesAuthConfig
+		expectError bool
+	}{
+		"valid directory": {
+			config: configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingDir, InvalidTokenExpiry: 60},
+		},
+		"valid file": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation: kidMappingFile,
+				KidMappingMode:         KidMappingModeFile,
+				InvalidTokenExpiry:     60,
+			},
+		},
+		"empty mapping location": {
+			config:      configuration.KubernetesAuthConfig{InvalidTokenExpiry: 60},
+			expectError: true,
+		},
+		"unreadable mapping location": {
+			config:      configuration.KubernetesAuthConfig{KidMappingFileLocation: filepath.Join(kidMappingDir, "missing"), InvalidTokenExpiry: 60},
+			expectError: true,
+		},
+		"per-kid audiences in file mode": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation: kidMappingFile,
+				KidMappingMode:         KidMappingModeFile,
+				PerKidAudiences:        true,
+			},
+			expectError: true,
+		},
+		"static JWKS in file mode": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation: kidMappingFile,
+				KidMappingMode:         KidMappingModeFile,
+				VerifyWithStaticJWKS:   true,
+			},
+			expectError: true,
+		},
+		"per-kid client certificates in file mode": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation:   kidMappingFile,
+				KidMappingMode:           KidMappingModeFile,
+				PerKidClientCertificates: true,
+			},
+			expectError: true,
+		},
+		"file given in directory mode": {
+			config:      configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingFile, InvalidTokenExpiry: 60},
+			expectError: true,
+		},
+		"unknown mapping mode": {
+			config:      configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingDir, KidMappingMode: "configmap", InvalidTokenExpiry: 60},
+			expectError: true,
+		},
+		"zero invalid token expiry": {
+			config: configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingDir},
+		},
+		"negative invalid token expiry": {
+			config: configuration.KubernetesAuthConfig{KidMappingFileLocation: kidMappingDir, InvalidTokenExpiry: -1},
+		},
+		"tokens without kid allowed with default cluster": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation: kidMappingDir,
+				InvalidTokenExpiry:     60,
+				AllowTokensWithoutKid:  true,
+				DefaultClusterURL:      testUrl,
+			},
+		},
+		"tokens without kid allowed without default cluster": {
+			config: configuration.KubernetesAuthConfig{
+				KidMappingFileLocation: kidMappingDir,
+				InvalidTokenExpiry:     60,
+				AllowTokensWithoutKid:  true,
+			},
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService, err := NewKubernetesNativeAuthServiceWithError(tc.config)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.config.KidMappingFileLocation, authService.KidMappingFileLocation)
+			}
+		})
+	}
+}
+
 type MockTokenReviewer struct {
 	Authenticated bool
 	Username      string
+	Groups        []string
 }
 
 func (reviewer *MockTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
@@ -102,6 +678,7 @@ func (reviewer *MockTokenReviewer) ReviewToken(ctx context.Context, clusterUrl s
 			Authenticated: reviewer.Authenticated,
 			User: authv1.UserInfo{
 				Username: reviewer.Username,
+				Groups:   reviewer.Groups,
 			},
 		},
 	}, nil
@@ -121,10 +698,1019 @@ func createTestAuthService(kidMapping string, authenticated bool, username strin
 	}
 }
 
+func encodeAuthBody(token string, ca []byte) string {
+	return EncodeKubernetesAuthHeader(token, ca)
+}
+
 func createKubernetesAuthPayload(token string, ca string) string {
-	encodedCa := base64.RawURLEncoding.EncodeToString([]byte(ca))
-	body := fmt.Sprintf(`{"token":"%s", "ca":"%s"}`, token, encodedCa)
-	return "KubernetesAuth " + base64.RawURLEncoding.EncodeToString([]byte(body))
+	return "KubernetesAuth " + encodeAuthBody(token, []byte(ca))
+}
+
+// createKidMappingDir writes a kid mapping for testKid pointing at testUrl and returns the directory, with a trailing slash.
+func createKidMappingDir(t *testing.T) string {
+	tempdir := t.TempDir()
+	err := os.WriteFile(filepath.Join(tempdir, testKid), []byte(testUrl), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write kid mapping: %s", err)
+	}
+	return tempdir + "/"
+}
+
+// createTestCA returns a PEM-encoded self-signed certificate.
+func createTestCA(t *testing.T) string {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+func TestValidateCA(t *testing.T) {
+	tests := map[string]struct {
+		ca          string
+		expectError bool
+	}{
+		"valid PEM":       {ca: createTestCA(t)},
+		"valid bundle":    {ca: createTestCA(t) + createTestCA(t)},
+		"empty":           {ca: ""},
+		"whitespace only": {ca: "\n"},
+		"garbage":         {ca: "not a certificate", expectError: true},
+		"garbage PEM":     {ca: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", expectError: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateCA([]byte(tc.ca))
+			if tc.expectError {
+				assert.ErrorContains(t, err, "invalid CA bundle")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_RejectsInvalidCA(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	reviewer := &CountingTokenReviewer{}
+	authService.TokenReviewer = reviewer
+	md := metautils.ExtractIncoming(context.Background())
+	md.Set("authorization", createKubernetesAuthPayload(testToken, "not a certificate"))
+
+	_, err := authService.AuthenticateGRPC(md.ToIncoming(context.Background()))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.ErrorContains(t, err, "invalid CA bundle")
+	assert.Equal(t, 0, reviewer.Calls)
+}
+
+func createAuthContext(token string) context.Context {
+	return createAuthContextWithKey("authorization", token)
+}
+
+func createAuthContextWithKey(key string, token string) context.Context {
+	ctx := context.Background()
+	metadata := metautils.ExtractIncoming(ctx)
+	metadata.Set(key, createKubernetesAuthPayload(token, testCA))
+	return metadata.ToIncoming(ctx)
+}
+
+func TestAuthenticate_WhitespaceInHeaderValue(t *testing.T) {
+	payload := encodeAuthBody(testToken, []byte(testCA))
+	tests := map[string]string{
+		"trailing newline":       "KubernetesAuth " + payload + "\n",
+		"leading space":          " KubernetesAuth " + payload,
+		"extra separating space": "KubernetesAuth  " + payload,
+		"crlf":                   "KubernetesAuth " + payload + "\r\n",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", value))
+
+			principal, err := authService.Authenticate(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, testName, principal.GetName())
+		})
+	}
+}
+
+func TestAuthenticate_CustomMetadataKey(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.MetadataKey = "x-armada-auth"
+
+	principal, err := authService.Authenticate(createAuthContextWithKey("x-armada-auth", testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	// Credentials under the standard key are ignored once a custom key is configured.
+	_, err = authService.Authenticate(createAuthContext(testToken))
+	assert.Equal(t, missingCredentials, err)
+}
+
+func TestAuthenticate_IssuedAtSkew(t *testing.T) {
+	// Without nbf, which would otherwise reject the token before its iat is checked.
+	token := createTestJWT(fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid), fmt.Sprintf(`{"exp":%d,"iat":%d}`, testTokenExp, testTokenIss))
+	tests := map[string]struct {
+		currentTime int64
+		maxSkew     time.Duration
+		expectError bool
+	}{
+		"disabled": {
+			currentTime: testTokenIss - 3600,
+			maxSkew:     0,
+			expectError: false,
+		},
+		"small future iat is accepted": {
+			currentTime: testTokenIss - 30,
+			maxSkew:     time.Minute,
+			expectError: false,
+		},
+		"egregious future iat is rejected": {
+			currentTime: testTokenIss - 3600,
+			maxSkew:     time.Minute,
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, tc.currentTime)
+			authService.MaxIssuedAtSkew = tc.maxSkew
+
+			principal, err := authService.Authenticate(createAuthContext(token))
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, principal)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testName, principal.GetName())
+			}
+		})
+	}
+}
+
+func TestValidateTemporalClaims(t *testing.T) {
+	now := time.Unix(testTokenIss, 0)
+	tests := map[string]struct {
+		claims      TemporalClaims
+		leeway      time.Duration
+		maxSkew     time.Duration
+		expectedErr error
+	}{
+		"no claims": {},
+		"all valid": {
+			claims: TemporalClaims{NotBefore: now.Add(-time.Minute), IssuedAt: now.Add(-time.Minute), Expiry: now.Add(time.Hour)},
+		},
+		"nbf now": {
+			claims: TemporalClaims{NotBefore: now},
+		},
+		"nbf in future": {
+			claims:      TemporalClaims{NotBefore: now.Add(time.Second)},
+			expectedErr: errTokenNotYetValid,
+		},
+		"nbf in future within leeway": {
+			claims: TemporalClaims{NotBefore: now.Add(time.Minute)},
+			leeway: time.Minute,
+		},
+		"nbf in future beyond leeway": {
+			claims:      TemporalClaims{NotBefore: now.Add(time.Minute + time.Second)},
+			leeway:      time.Minute,
+			expectedErr: errTokenNotYetValid,
+		},
+		"iat in future with skew check disabled": {
+			claims: TemporalClaims{IssuedAt: now.Add(time.Hour)},
+		},
+		"iat in future within skew": {
+			claims:  TemporalClaims{IssuedAt: now.Add(time.Minute)},
+			maxSkew: time.Minute,
+		},
+		"iat in future beyond skew": {
+			claims:      TemporalClaims{IssuedAt: now.Add(time.Minute + time.Second)},
+			maxSkew:     time.Minute,
+			expectedErr: errTokenIssuedInFuture,
+		},
+		"iat skew unaffected by leeway": {
+			claims:      TemporalClaims{IssuedAt: now.Add(time.Hour)},
+			leeway:      2 * time.Hour,
+			maxSkew:     time.Minute,
+			expectedErr: errTokenIssuedInFuture,
+		},
+		"exp in future": {
+			claims: TemporalClaims{Expiry: now.Add(time.Second)},
+		},
+		"exp now": {
+			claims:      TemporalClaims{Expiry: now},
+			expectedErr: errTokenExpired,
+		},
+		"exp in past within leeway": {
+			claims: TemporalClaims{Expiry: now.Add(-time.Minute + time.Second)},
+			leeway: time.Minute,
+		},
+		"exp in past beyond leeway": {
+			claims:      TemporalClaims{Expiry: now.Add(-time.Minute)},
+			leeway:      time.Minute,
+			expectedErr: errTokenExpired,
+		},
+		"nbf reported before exp": {
+			claims:      TemporalClaims{NotBefore: now.Add(time.Hour), Expiry: now.Add(-time.Hour)},
+			expectedErr: errTokenNotYetValid,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateTemporalClaims(tc.claims, now, tc.leeway, tc.maxSkew)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestAuthenticate_ExpiredWithinLeewayNotCached(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenExp+30)
+	authService.ClockSkewLeeway = time.Minute
+	samplesBefore := histogramSampleCount(t, cachedTokenRemainingLifetime)
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	assert.Zero(t, authService.TokenCache.ItemCount())
+	_, cached := authService.CacheTTL(testToken)
+	assert.False(t, cached)
+	assert.Equal(t, samplesBefore, histogramSampleCount(t, cachedTokenRemainingLifetime))
+}
+
+func TestAuthenticate_NotBefore(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss-30)
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.Equal(t, errTokenNotYetValid, err)
+
+	authService.ClockSkewLeeway = time.Minute
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+}
+
+func TestAuthenticate_TokenCacheBypass(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenCache.Set(authService.tokenCacheKey(testToken), CacheData{Name: "cached-user", Valid: true}, time.Minute)
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, "cached-user", principal.GetName())
+
+	// Bypassing the cache forces a fresh review, whose result replaces the cached entry.
+	principal, err = authService.Authenticate(WithTokenCacheBypass(createAuthContext(testToken)))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	data, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.True(t, found)
+	assert.Equal(t, CacheData{Name: testName, Kid: testKid, ClusterURL: testUrl, Valid: true}, data)
+}
+
+func TestAuthenticate_SplitUsernameGroups(t *testing.T) {
+	tests := map[string]struct {
+		username       string
+		split          bool
+		expectedName   string
+		expectedGroups []string
+	}{
+		"split convention": {
+			username:       "admin-user|group1,group2",
+			split:          true,
+			expectedName:   "admin-user",
+			expectedGroups: []string{"admin-user", "group1", "group2", EveryoneGroup},
+		},
+		"normal username": {
+			username:       testName,
+			split:          true,
+			expectedName:   testName,
+			expectedGroups: []string{testName, EveryoneGroup},
+		},
+		"disabled": {
+			username:       "admin-user|group1,group2",
+			split:          false,
+			expectedName:   "admin-user|group1,group2",
+			expectedGroups: []string{"admin-user|group1,group2", EveryoneGroup},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, tc.username, testTokenIss)
+			authService.SplitUsernameGroups = tc.split
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, principal.GetName())
+			assert.ElementsMatch(t, tc.expectedGroups, principal.GetGroupNames())
+		})
+	}
+}
+
+func TestAuthenticate_DefaultGroups(t *testing.T) {
+	tests := map[string]struct {
+		useReviewGroups bool
+		reviewGroups    []string
+		expectedGroups  []string
+	}{
+		"empty groups get defaults": {
+			useReviewGroups: true,
+			reviewGroups:    nil,
+			expectedGroups:  []string{testName, "authenticated", EveryoneGroup},
+		},
+		"non-empty groups left alone": {
+			useReviewGroups: true,
+			reviewGroups:    []string{"system:serviceaccounts"},
+			expectedGroups:  []string{testName, "system:serviceaccounts", EveryoneGroup},
+		},
+		"review groups ignored by default": {
+			reviewGroups:   []string{"system:serviceaccounts"},
+			expectedGroups: []string{testName, "authenticated", EveryoneGroup},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.TokenReviewer = &MockTokenReviewer{Authenticated: true, Username: testName, Groups: tc.reviewGroups}
+			authService.UseTokenReviewGroups = tc.useReviewGroups
+			authService.DefaultGroups = []string{"authenticated"}
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expectedGroups, principal.GetGroupNames())
+
+			// Cached principals are built the same way.
+			principal, err = authService.Authenticate(createAuthContext(testToken))
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expectedGroups, principal.GetGroupNames())
+		})
+	}
+}
+
+type PanickingKidMappingSource struct{}
+
+func (source *PanickingKidMappingSource) GetClusterURL(kid string) (string, error) {
+	panic("reflect: call of reflect.Value.Interface on zero Value")
+}
+
+func TestAuthenticate_UsernameGroup(t *testing.T) {
+	tests := map[string]struct {
+		excludeUsername bool
+		reviewGroups    []string
+		expectedGroups  []string
+	}{
+		"username included": {
+			reviewGroups:   []string{"system:serviceaccounts"},
+			expectedGroups: []string{testName, "system:serviceaccounts", EveryoneGroup},
+		},
+		"username also in review groups deduped": {
+			reviewGroups:   []string{testName, "system:serviceaccounts", "system:serviceaccounts"},
+			expectedGroups: []string{testName, "system:serviceaccounts", EveryoneGroup},
+		},
+		"username excluded": {
+			excludeUsername: true,
+			reviewGroups:    []string{"system:serviceaccounts"},
+			expectedGroups:  []string{"system:serviceaccounts", EveryoneGroup},
+		},
+		"username excluded but in review groups": {
+			excludeUsername: true,
+			reviewGroups:    []string{testName},
+			expectedGroups:  []string{testName, EveryoneGroup},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.TokenReviewer = &MockTokenReviewer{Authenticated: true, Username: testName, Groups: tc.reviewGroups}
+			authService.UseTokenReviewGroups = true
+			authService.ExcludeUsernameFromGroups = tc.excludeUsername
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expectedGroups, principal.GetGroupNames())
+		})
+	}
+}
+
+func TestDedupeGroups(t *testing.T) {
+	assert.Equal(t, []string{testName, "a", "b"}, dedupeGroups([]string{testName, "a", testName, "b", "a"}))
+	assert.Equal(t, []string{}, dedupeGroups(nil))
+}
+
+func TestAuthenticate_SubjectFallback(t *testing.T) {
+	header := fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid)
+	tests := map[string]struct {
+		username     string
+		payload      string
+		expectedName string
+		expectError  bool
+	}{
+		"username preferred over sub": {
+			username:     testName,
+			payload:      fmt.Sprintf(`{"exp":%d,"sub":"system:serviceaccount:default:other"}`, testTokenExp),
+			expectedName: testName,
+		},
+		"empty username falls back to sub": {
+			payload:      fmt.Sprintf(`{"exp":%d,"sub":"system:serviceaccount:default:other"}`, testTokenExp),
+			expectedName: "system:serviceaccount:default:other",
+		},
+		"empty username and sub": {
+			payload:     fmt.Sprintf(`{"exp":%d}`, testTokenExp),
+			expectError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, tc.username, testTokenIss)
+
+			principal, err := authService.Authenticate(createAuthContext(createTestJWT(header, tc.payload)))
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Equal(t, 0, authService.TokenCache.ItemCount())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedName, principal.GetName())
+			}
+		})
+	}
+}
+
+func TestAuthenticate_SetInvalidTokenExpiry(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), false, testName, testTokenIss)
+	header := fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid)
+	firstToken := createTestJWT(header, fmt.Sprintf(`{"exp":%d,"sub":"first"}`, testTokenExp))
+	secondToken := createTestJWT(header, fmt.Sprintf(`{"exp":%d,"sub":"second"}`, testTokenExp))
+
+	authService.SetInvalidTokenExpiry(time.Minute)
+	_, err := authService.Authenticate(createAuthContext(firstToken))
+	assert.Error(t, err)
+	_, expiration, found := authService.TokenCache.GetWithExpiration(authService.tokenCacheKey(firstToken))
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiration, 10*time.Second)
+
+	authService.SetInvalidTokenExpiry(time.Hour)
+	_, err = authService.Authenticate(createAuthContext(secondToken))
+	assert.Error(t, err)
+	_, expiration, found = authService.TokenCache.GetWithExpiration(authService.tokenCacheKey(secondToken))
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiration, 10*time.Second)
+}
+
+func TestAuthenticate_RejectionsNotCachedWithoutInvalidTokenExpiry(t *testing.T) {
+	for _, expiry := range []time.Duration{0, -1} {
+		t.Run(expiry.String(), func(t *testing.T) {
+			reviewer := &CountingTokenReviewer{Result: &authv1.TokenReview{Status: authv1.TokenReviewStatus{Authenticated: false}}}
+			authService := createTestAuthService(createKidMappingDir(t), false, testName, testTokenIss)
+			authService.TokenReviewer = reviewer
+			authService.SetInvalidTokenExpiry(expiry)
+
+			for i := 0; i < 2; i++ {
+				_, err := authService.Authenticate(createAuthContext(testToken))
+				assert.Error(t, err)
+			}
+			assert.Equal(t, 2, reviewer.Calls)
+			assert.Zero(t, authService.TokenCache.ItemCount())
+		})
+	}
+}
+
+func TestTokenCacheKey(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	key := authService.tokenCacheKey(testToken)
+	assert.Equal(t, key, authService.tokenCacheKey(testToken))
+	assert.NotEqual(t, key, authService.tokenCacheKey(testTokenNoExp))
+	assert.NotContains(t, key, testToken)
+
+	// Valid results are cached under the key, and read back from it.
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{key}, cacheKeys(authService.TokenCache))
+	authService.TokenReviewer = &MockTokenReviewer{Authenticated: false}
+	_, err = authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err, "result should have been read from the cache")
+
+	_, found := authService.CacheTTL(testToken)
+	assert.True(t, found)
+
+	authService.InvalidateToken(testToken)
+	assert.Empty(t, cacheKeys(authService.TokenCache))
+
+	// Rejections are cached under the key too.
+	authService.SetInvalidTokenExpiry(time.Minute)
+	_, err = authService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.Equal(t, []string{key}, cacheKeys(authService.TokenCache))
+}
+
+func cacheKeys(c *cache.Cache) []string {
+	keys := []string{}
+	for key := range c.Items() {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestCacheTTL(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+
+	_, found := authService.CacheTTL(testToken)
+	assert.False(t, found)
+
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+
+	ttl, found := authService.CacheTTL(testToken)
+	assert.True(t, found)
+	expectedTTL := time.Duration(testTokenExp-testTokenIss) * time.Second
+	assert.LessOrEqual(t, ttl, expectedTTL)
+	assert.Greater(t, ttl, expectedTTL-10*time.Second)
+}
+
+func TestAuthenticateGRPC(t *testing.T) {
+	header := fmt.Sprintf(`{"alg":"RS256","kid":"%s"}`, testKid)
+	tests := map[string]struct {
+		ctx          context.Context
+		currentTime  int64
+		reviewer     TokenReviewer
+		expectedCode codes.Code
+	}{
+		"authenticated": {
+			ctx:          createAuthContext(testToken),
+			expectedCode: codes.OK,
+		},
+		"missing credentials": {
+			ctx:          context.Background(),
+			expectedCode: codes.InvalidArgument,
+		},
+		"malformed token": {
+			ctx:          createAuthContext("not.a-jwt"),
+			expectedCode: codes.InvalidArgument,
+		},
+		"malformed header": {
+			ctx:          createAuthContext(createTestJWT("not json", fmt.Sprintf(`{"exp":%d}`, testTokenExp))),
+			expectedCode: codes.InvalidArgument,
+		},
+		"expired": {
+			ctx:          createAuthContext(testToken),
+			currentTime:  testTokenExp + 1,
+			expectedCode: codes.Unauthenticated,
+		},
+		"unknown kid": {
+			ctx:          createAuthContext(createTestJWT(`{"alg":"RS256","kid":"unknown"}`, fmt.Sprintf(`{"exp":%d}`, testTokenExp))),
+			expectedCode: codes.Unauthenticated,
+		},
+		"rejected": {
+			ctx:          createAuthContext(createTestJWT(header, fmt.Sprintf(`{"exp":%d}`, testTokenExp))),
+			reviewer:     &MockTokenReviewer{Authenticated: false},
+			expectedCode: codes.Unauthenticated,
+		},
+		"review failed": {
+			ctx:          createAuthContext(testToken),
+			reviewer:     &CountingTokenReviewer{Err: errors.New("connection refused")},
+			expectedCode: codes.Internal,
+		},
+		"cancelled": {
+			ctx:          createAuthContext(testToken),
+			reviewer:     &CountingTokenReviewer{Err: fmt.Errorf("review failed: %w", context.Canceled)},
+			expectedCode: codes.Canceled,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			currentTime := tc.currentTime
+			if currentTime == 0 {
+				currentTime = testTokenIss
+			}
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, currentTime)
+			if tc.reviewer != nil {
+				authService.TokenReviewer = tc.reviewer
+			}
+
+			_, err := authService.AuthenticateGRPC(tc.ctx)
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestAuthenticate_RecoversFromPanic(t *testing.T) {
+	authService := createTestAuthService("", true, testName, testTokenIss)
+	authService.KidMappingSource = &PanickingKidMappingSource{}
+	panicsBefore := testutil.ToFloat64(authPanicsTotal)
+	failures := authFailuresTotal.WithLabelValues(unknownKidLabel, authFailureRejected)
+	failuresBefore := testutil.ToFloat64(failures)
+
+	// Panics are reported as rejections.
+	principal, err := authService.AuthenticateGRPC(createAuthContext(testToken))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Nil(t, principal)
+	assert.Equal(t, panicsBefore+1, testutil.ToFloat64(authPanicsTotal))
+	assert.Equal(t, failuresBefore+1, testutil.ToFloat64(failures))
+
+	authService.DisablePanicRecovery = true
+	assert.Panics(t, func() {
+		authService.Authenticate(createAuthContext(testToken))
+	})
+}
+
+func TestAuthenticate_RecoversFromPanicInCoalescedReview(t *testing.T) {
+	authService := createTestAuthService("", true, testName, testTokenIss)
+	authService.KidMappingSource = &PanickingKidMappingSource{}
+	authService.ReviewGroup = &singleflight.Group{}
+	panicsBefore := testutil.ToFloat64(authPanicsTotal)
+
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.Nil(t, principal)
+	assert.Equal(t, panicsBefore+1, testutil.ToFloat64(authPanicsTotal))
+
+	// Without recovery, the panic reaches the caller rather than a goroutine of the review group's.
+	authService.DisablePanicRecovery = true
+	assert.Panics(t, func() {
+		authService.Authenticate(createAuthContext(testToken))
+	})
+}
+
+func TestAuthenticate_PostAuthHook(t *testing.T) {
+	const rejectedName = "system:serviceaccount:default:untrusted"
+	hook := func(ctx context.Context, user authv1.UserInfo) error {
+		if user.Username == rejectedName {
+			return fmt.Errorf("service account %s is not allowed", user.Username)
+		}
+		return nil
+	}
+
+	authService := createTestAuthService(createKidMappingDir(t), true, rejectedName, testTokenIss)
+	authService.PostAuthHook = hook
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.Error(t, err)
+	assert.Nil(t, principal)
+	_, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.False(t, found)
+
+	authService = createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.PostAuthHook = hook
+	principal, err = authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	_, found = authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.True(t, found)
+}
+
+func TestAuthenticate_AllowedNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		username    string
+		expectError bool
+	}{
+		"allowed namespace":            {username: "system:serviceaccount:armada:executor"},
+		"disallowed namespace":         {username: "system:serviceaccount:default:executor", expectError: true},
+		"not a service account":        {username: testName, expectError: true},
+		"service account without name": {username: "system:serviceaccount:armada", expectError: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, tc.username, testTokenIss)
+			authService.AllowedNamespaces = []string{"armada", "other"}
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			_, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.False(t, found)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.username, principal.GetName())
+				assert.True(t, found)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_TrailerFallback(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	trailer := metadata.Pairs("authorization", createKubernetesAuthPayload(testToken, testCA))
+	ctx := WithIncomingTrailer(context.Background(), trailer)
+
+	principal, err := authService.Authenticate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	_, err = authService.Authenticate(context.Background())
+	assert.Equal(t, missingCredentials, err)
+}
+
+func TestAuthenticate_CacheRefreshThreshold(t *testing.T) {
+	const threshold = 5 * time.Minute
+	tests := map[string]struct {
+		currentTime  int64
+		reviewErr    error
+		expectedName string
+	}{
+		"outside threshold served from cache": {
+			currentTime:  testTokenExp - int64(threshold.Seconds()) - 1,
+			expectedName: "cached-user",
+		},
+		"inside threshold refreshed": {
+			currentTime:  testTokenExp - int64(threshold.Seconds()) + 1,
+			expectedName: testName,
+		},
+		"failed refresh keeps cached entry": {
+			currentTime:  testTokenExp - int64(threshold.Seconds()) + 1,
+			reviewErr:    fmt.Errorf("connection refused"),
+			expectedName: "cached-user",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, tc.currentTime)
+			authService.CacheRefreshThreshold = threshold
+			authService.TokenReviewer = &CountingTokenReviewer{
+				Result: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+					Authenticated: true,
+					User:          authv1.UserInfo{Username: testName},
+				}},
+				Err: tc.reviewErr,
+			}
+			authService.TokenCache.Set(authService.tokenCacheKey(testToken), CacheData{Name: "cached-user", Valid: true}, time.Minute)
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, principal.GetName())
+
+			data, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+			assert.True(t, found)
+			assert.Equal(t, tc.expectedName, data.(CacheData).Name)
+		})
+	}
+}
+
+func TestAuthenticate_CacheRefreshRevokedToken(t *testing.T) {
+	const threshold = 5 * time.Minute
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenExp-int64(threshold.Seconds())+1)
+	authService.CacheRefreshThreshold = threshold
+	authService.TokenReviewer = &CountingTokenReviewer{Err: apierrors.NewUnauthorized("Unauthorized")}
+	authService.SetInvalidTokenExpiry(time.Minute)
+	authService.TokenCache.Set(authService.tokenCacheKey(testToken), CacheData{Name: "cached-user", Valid: true}, time.Minute)
+
+	_, err := authService.AuthenticateGRPC(createAuthContext(testToken))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	data, found := authService.TokenCache.Get(authService.tokenCacheKey(testToken))
+	assert.True(t, found)
+	assert.False(t, data.(CacheData).Valid)
+}
+
+func TestAuthenticate_CacheRefreshOncePerWindow(t *testing.T) {
+	const threshold = 5 * time.Minute
+	for name, reviewErr := range map[string]error{"successful refresh": nil, "failed refresh": fmt.Errorf("connection refused")} {
+		t.Run(name, func(t *testing.T) {
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenExp-int64(threshold.Seconds())+1)
+			authService.CacheRefreshThreshold = threshold
+			reviewer := &CountingTokenReviewer{
+				Result: &authv1.TokenReview{Status: authv1.TokenReviewStatus{
+					Authenticated: true,
+					User:          authv1.UserInfo{Username: testName},
+				}},
+				Err: reviewErr,
+			}
+			authService.TokenReviewer = reviewer
+			authService.TokenCache.Set(authService.tokenCacheKey(testToken), CacheData{Name: testName, Valid: true}, time.Minute)
+
+			for i := 0; i < 3; i++ {
+				principal, err := authService.Authenticate(createAuthContext(testToken))
+				assert.NoError(t, err)
+				assert.Equal(t, testName, principal.GetName())
+			}
+			assert.Equal(t, 1, reviewer.Calls)
+		})
+	}
+}
+
+func TestAuthenticateWithInfo(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = &MockTokenReviewer{Authenticated: true, Username: testName, Groups: []string{"system:serviceaccounts"}}
+
+	principal, info, err := authService.AuthenticateWithInfo(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	expected := TokenInfo{
+		Kid:        testKid,
+		ClusterURL: testUrl,
+		Expiry:     time.Unix(testTokenExp, 0),
+		FromCache:  false,
+		Groups:     []string{"system:serviceaccounts"},
+	}
+	assert.Equal(t, expected, info)
+
+	principal, info, err = authService.AuthenticateWithInfo(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	expected.FromCache = true
+	assert.Equal(t, expected, info)
+}
+
+func TestAuthenticateRaw(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	reviewer := &CountingTokenReviewer{Result: &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{Token: testToken},
+		Status: authv1.TokenReviewStatus{
+			Authenticated: true,
+			User: authv1.UserInfo{
+				Username: testName,
+				Extra:    map[string]authv1.ExtraValue{"example.com/team": {"platform"}},
+			},
+		},
+	}}
+	authService.TokenReviewer = reviewer
+
+	principal, review, err := authService.AuthenticateRaw(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	if assert.NotNil(t, review) {
+		assert.Equal(t, authv1.ExtraValue{"platform"}, review.Status.User.Extra["example.com/team"])
+		assert.Empty(t, review.Spec.Token)
+	}
+	assert.Equal(t, testToken, reviewer.Result.Spec.Token, "the reviewer's result should not be modified")
+
+	principal, review, err = authService.AuthenticateRaw(createAuthContext(testToken))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	assert.Nil(t, review)
+	assert.Equal(t, 1, reviewer.Calls)
+}
+
+func TestAuthenticate_NonExpiringTokens(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	_, err := authService.Authenticate(createAuthContext(testTokenNoExp))
+	assert.Error(t, err)
+
+	authService = createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.AllowNonExpiringTokens = true
+	authService.NonExpiringTokenCacheTTL = time.Hour
+	principal, info, err := authService.AuthenticateWithInfo(createAuthContext(testTokenNoExp))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	assert.Equal(t, time.Unix(testTokenIss, 0).Add(time.Hour), info.Expiry)
+
+	_, expiration, found := authService.TokenCache.GetWithExpiration(authService.tokenCacheKey(testTokenNoExp))
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiration, time.Minute)
+}
+
+// BlockingTokenReviewer authenticates every token, but only once release is closed.
+type BlockingTokenReviewer struct {
+	started chan struct{}
+	release chan struct{}
+	calls   int32
+}
+
+func (reviewer *BlockingTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	if atomic.AddInt32(&reviewer.calls, 1) == 1 {
+		close(reviewer.started)
+	}
+	select {
+	case <-reviewer.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &authv1.TokenReview{
+		Status: authv1.TokenReviewStatus{
+			Authenticated: true,
+			User:          authv1.UserInfo{Username: testName},
+		},
+	}, nil
+}
+
+func TestAuthenticate_CoalescedReviewRespectsCallerContext(t *testing.T) {
+	reviewer := &BlockingTokenReviewer{started: make(chan struct{}), release: make(chan struct{})}
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = reviewer
+	authService.ReviewGroup = &singleflight.Group{}
+
+	cancelledCtx, cancel := context.WithCancel(createAuthContext(testToken))
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := authService.Authenticate(cancelledCtx)
+		cancelledErr <- err
+	}()
+	<-reviewer.started
+
+	type result struct {
+		principal Principal
+		err       error
+	}
+	waiting := make(chan result)
+	go func() {
+		principal, err := authService.Authenticate(createAuthContext(testToken))
+		waiting <- result{principal, err}
+	}()
+
+	// The cancelled caller gives up immediately, even though the shared review is still in progress.
+	cancel()
+	assert.ErrorIs(t, <-cancelledErr, context.Canceled)
+
+	// Once the shared review completes, the other caller gets its result.
+	close(reviewer.release)
+	r := <-waiting
+	assert.NoError(t, r.err)
+	assert.Equal(t, testName, r.principal.GetName())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reviewer.calls))
+}
+
+func TestAuthenticate_CoalescedReviewTimesOut(t *testing.T) {
+	reviewer := &BlockingTokenReviewer{started: make(chan struct{}), release: make(chan struct{})}
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = reviewer
+	authService.ReviewGroup = &singleflight.Group{}
+	authService.TokenReviewTimeout = 10 * time.Millisecond
+
+	// The caller's context has no deadline, so only TokenReviewTimeout ends the review.
+	_, err := authService.Authenticate(createAuthContext(testToken))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reviewer.calls))
+}
+
+func TestAuthenticate_CoalescesReviewsOnlyForSameCA(t *testing.T) {
+	reviewer := &BlockingTokenReviewer{started: make(chan struct{}), release: make(chan struct{})}
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	authService.TokenReviewer = reviewer
+	authService.ReviewGroup = &singleflight.Group{}
+
+	errs := make(chan error)
+	for _, ca := range []string{testCA, createTestCA(t)} {
+		md := metadata.Pairs("authorization", createKubernetesAuthPayload(testToken, ca))
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		go func() {
+			_, err := authService.Authenticate(ctx)
+			errs <- err
+		}()
+	}
+	<-reviewer.started
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&reviewer.calls) == 2 }, time.Second, time.Millisecond)
+
+	close(reviewer.release)
+	assert.NoError(t, <-errs)
+	assert.NoError(t, <-errs)
+}
+
+func TestAuthenticate_MultipleAuthorizationValues(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	md := metadata.MD{}
+	md.Append("authorization", "Bearer some-oidc-token")
+	md.Append("authorization", createKubernetesAuthPayload(testToken, testCA))
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	principal, err := authService.Authenticate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+}
+
+// AudienceTokenReviewer authenticates every token, reporting the given audiences as validated
+// and recording the audiences requested.
+type AudienceTokenReviewer struct {
+	ValidatedAudiences []string
+	RequestedAudiences []string
+}
+
+func (reviewer *AudienceTokenReviewer) ReviewToken(ctx context.Context, clusterUrl string, token string, ca []byte) (*authv1.TokenReview, error) {
+	reviewer.RequestedAudiences = TokenReviewAudiences(ctx)
+	return &authv1.TokenReview{
+		Status: authv1.TokenReviewStatus{
+			Authenticated: true,
+			User:          authv1.UserInfo{Username: testName},
+			Audiences:     reviewer.ValidatedAudiences,
+		},
+	}, nil
+}
+
+func TestAuthenticate_Audiences(t *testing.T) {
+	tests := map[string]struct {
+		validatedAudiences []string
+		expectError        bool
+	}{
+		"matching audience": {
+			validatedAudiences: []string{"other", "armada"},
+		},
+		"mismatched audiences": {
+			validatedAudiences: []string{"https://kubernetes.default.svc.cluster.local"},
+			expectError:        true,
+		},
+		"audiences ignored by api server": {
+			validatedAudiences: nil,
+			expectError:        true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			reviewer := &AudienceTokenReviewer{ValidatedAudiences: tc.validatedAudiences}
+			authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+			authService.TokenReviewer = reviewer
+			authService.Audiences = []string{"armada"}
+
+			principal, err := authService.Authenticate(createAuthContext(testToken))
+			assert.Equal(t, []string{"armada"}, reviewer.RequestedAudiences)
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, principal)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testName, principal.GetName())
+			}
+		})
+	}
 }
 
 func TestAuthenticate(t *testing.T) {
@@ -144,17 +1730,42 @@ func TestAuthenticate(t *testing.T) {
 	kidfile.Write([]byte(testUrl))
 
 	// Create authentication context
-	payload := createKubernetesAuthPayload(testToken, testCA)
-	ctx := context.Background()
-	metadata := metautils.ExtractIncoming(ctx)
-	metadata.Set("authorization", payload)
-	ctx = metadata.ToIncoming(ctx)
+	ctx := createAuthContext(testToken)
 
 	// Authenticate
 	authService := createTestAuthService(tempdir+"/", true, testName, testTokenIss)
 	principal, err := authService.Authenticate(ctx)
 
-	expected := NewStaticPrincipal(testName, []string{testName})
+	expected := NewExpiringPrincipal(NewStaticPrincipal(testName, []string{testName}), time.Unix(testTokenExp, 0))
 	assert.NoError(t, err)
 	assert.Equal(t, expected, principal)
 }
+
+func TestAuthenticate_PrincipalDeadline(t *testing.T) {
+	authService := createTestAuthService(createKidMappingDir(t), true, testName, testTokenIss)
+	for _, fromCache := range []bool{false, true} {
+		principal, info, err := authService.AuthenticateWithInfo(createAuthContext(testToken))
+		assert.NoError(t, err)
+		assert.Equal(t, fromCache, info.FromCache)
+		deadline, ok := PrincipalDeadline(principal)
+		assert.True(t, ok)
+		assert.Equal(t, time.Unix(testTokenExp, 0), deadline)
+	}
+
+	// Tokens accepted after expiry, within the leeway, give principals whose deadline hasn't passed.
+	authService = createTestAuthService(createKidMappingDir(t), true, testName, testTokenExp+1)
+	authService.ClockSkewLeeway = 30 * time.Second
+	principal, err := authService.Authenticate(createAuthContext(testToken))
+	assert.NoError(t, err)
+	deadline, ok := PrincipalDeadline(principal)
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(testTokenExp, 0).Add(30*time.Second), deadline)
+	assert.True(t, deadline.After(authService.Clock.Now()))
+
+	// Tokens without an exp claim give principals without a deadline, even though their review is cached for a time.
+	authService.AllowNonExpiringTokens = true
+	principal, err = authService.Authenticate(createAuthContext(testTokenNoExp))
+	assert.NoError(t, err)
+	_, ok = PrincipalDeadline(principal)
+	assert.False(t, ok)
+}
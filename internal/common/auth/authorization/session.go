@@ -0,0 +1,120 @@
+package authorization
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// Authorization scheme identifying Armada session tokens.
+const sessionTokenScheme = "ArmadaSession"
+
+// Minimum length of the key session tokens are signed with.
+const minSessionKeyLength = 32
+
+// SessionTokenIssuer issues and verifies Armada session tokens: HMAC-signed tokens recording a Principal's name
+// and groups. A client authenticated once by another AuthService, e.g. with an expensive-to-review Kubernetes
+// token, can exchange its credentials for a session token, which is then verified without contacting any cluster.
+// Session tokens can't be revoked before they expire, so ttl should be short.
+type SessionTokenIssuer struct {
+	key   []byte
+	Clock clock.Clock
+}
+
+func NewSessionTokenIssuer(key []byte) (*SessionTokenIssuer, error) {
+	if len(key) < minSessionKeyLength {
+		return nil, fmt.Errorf("session token key must be at least %d bytes, but got %d", minSessionKeyLength, len(key))
+	}
+	return &SessionTokenIssuer{key: append([]byte(nil), key...), Clock: clock.RealClock{}}, nil
+}
+
+// sessionClaims is the payload of a session token.
+type sessionClaims struct {
+	Name     string   `json:"name"`
+	Groups   []string `json:"groups,omitempty"`
+	IssuedAt int64    `json:"iat"`
+	Expiry   int64    `json:"exp"`
+}
+
+// IssueSessionToken returns a session token for principal, valid for ttl.
+func (issuer *SessionTokenIssuer) IssueSessionToken(principal Principal, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", fmt.Errorf("session token ttl must be positive, but got %s", ttl)
+	}
+	groups := []string{}
+	for _, group := range principal.GetGroupNames() {
+		// Given to every principal on verification.
+		if group != EveryoneGroup {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	now := issuer.Clock.Now()
+	payload, err := json.Marshal(sessionClaims{
+		Name:     principal.GetName(),
+		Groups:   groups,
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(issuer.sign(encodedPayload)), nil
+}
+
+// VerifySessionToken checks token was issued by an issuer with the same key and hasn't expired,
+// returning the Principal it was issued for.
+func (issuer *SessionTokenIssuer) VerifySessionToken(token string) (Principal, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, &malformedTokenError{"malformed session token"}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, &malformedTokenError{fmt.Sprintf("malformed session token signature: %s", err)}
+	}
+	if !hmac.Equal(signature, issuer.sign(encodedPayload)) {
+		return nil, &tokenRejectedError{"invalid session token signature"}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, &malformedTokenError{fmt.Sprintf("malformed session token payload: %s", err)}
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, &malformedTokenError{fmt.Sprintf("malformed session token payload: %s", err)}
+	}
+	if !issuer.Clock.Now().Before(time.Unix(claims.Expiry, 0)) {
+		return nil, &tokenRejectedError{"session token expired"}
+	}
+	return NewStaticPrincipal(claims.Name, claims.Groups), nil
+}
+
+func (issuer *SessionTokenIssuer) sign(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, issuer.key)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// SessionAuthService authenticates requests carrying "ArmadaSession <token>" credentials issued by Issuer.
+type SessionAuthService struct {
+	Issuer *SessionTokenIssuer
+}
+
+func (authService *SessionAuthService) Authenticate(ctx context.Context) (Principal, error) {
+	token, err := grpc_auth.AuthFromMD(ctx, sessionTokenScheme)
+	if err != nil {
+		return nil, missingCredentials
+	}
+	return authService.Issuer.VerifySessionToken(token)
+}
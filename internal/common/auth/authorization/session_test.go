@@ -0,0 +1,94 @@
+package authorization
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+var testSessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func createTestSessionTokenIssuer(t *testing.T, key []byte, now time.Time) *SessionTokenIssuer {
+	issuer, err := NewSessionTokenIssuer(key)
+	assert.NoError(t, err)
+	issuer.Clock = clock.NewFakeClock(now)
+	return issuer
+}
+
+func TestSessionToken_RoundTrip(t *testing.T) {
+	issuer := createTestSessionTokenIssuer(t, testSessionKey, time.Unix(testTokenIss, 0))
+	token, err := issuer.IssueSessionToken(NewStaticPrincipal(testName, []string{"executors", testName}), time.Hour)
+	assert.NoError(t, err)
+
+	principal, err := issuer.VerifySessionToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+	assert.ElementsMatch(t, []string{"executors", testName, EveryoneGroup}, principal.GetGroupNames())
+}
+
+func TestSessionToken_Expiry(t *testing.T) {
+	issuer := createTestSessionTokenIssuer(t, testSessionKey, time.Unix(testTokenIss, 0))
+	fakeClock := issuer.Clock.(*clock.FakeClock)
+	token, err := issuer.IssueSessionToken(NewStaticPrincipal(testName, nil), time.Minute)
+	assert.NoError(t, err)
+
+	fakeClock.Step(time.Minute - time.Second)
+	_, err = issuer.VerifySessionToken(token)
+	assert.NoError(t, err)
+
+	fakeClock.Step(time.Second)
+	_, err = issuer.VerifySessionToken(token)
+	assert.ErrorContains(t, err, "expired")
+}
+
+func TestSessionToken_Rejected(t *testing.T) {
+	now := time.Unix(testTokenIss, 0)
+	issuer := createTestSessionTokenIssuer(t, testSessionKey, now)
+	token, err := issuer.IssueSessionToken(NewStaticPrincipal(testName, nil), time.Hour)
+	assert.NoError(t, err)
+	payload, signature, _ := strings.Cut(token, ".")
+	forgedPayload, err := createTestSessionTokenIssuer(t, []byte(strings.Repeat("x", 32)), now).
+		IssueSessionToken(NewStaticPrincipal("admin", []string{"admins"}), time.Hour)
+	assert.NoError(t, err)
+
+	tests := map[string]string{
+		"signed with another key": forgedPayload,
+		"payload swapped":         strings.Split(forgedPayload, ".")[0] + "." + signature,
+		"signature truncated":     payload + "." + signature[:10],
+		"no signature":            payload,
+		"signature not base64":    payload + ".!!!",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			principal, err := issuer.VerifySessionToken(token)
+			assert.Error(t, err)
+			assert.Nil(t, principal)
+		})
+	}
+}
+
+func TestNewSessionTokenIssuer_ShortKey(t *testing.T) {
+	_, err := NewSessionTokenIssuer([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestSessionAuthService(t *testing.T) {
+	issuer := createTestSessionTokenIssuer(t, testSessionKey, time.Now())
+	token, err := issuer.IssueSessionToken(NewStaticPrincipal(testName, nil), time.Hour)
+	assert.NoError(t, err)
+	authService := &SessionAuthService{Issuer: issuer}
+
+	md := metautils.ExtractIncoming(context.Background())
+	md.Set("authorization", sessionTokenScheme+" "+token)
+	principal, err := authService.Authenticate(md.ToIncoming(context.Background()))
+	assert.NoError(t, err)
+	assert.Equal(t, testName, principal.GetName())
+
+	_, err = authService.Authenticate(context.Background())
+	assert.Equal(t, missingCredentials, err)
+}
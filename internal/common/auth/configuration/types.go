@@ -14,6 +14,11 @@ type AuthConfig struct {
 	OpenIdAuth     OpenIdAuthenticationConfig
 	Kerberos       KerberosAuthenticationConfig
 
+	// Priority of each auth method, keyed by "anonymous", "basic", "kubernetes", "openid" or "kerberos".
+	// Methods with higher priority are tried first when a request carries credentials for several of them.
+	// Methods with equal priority, including those not listed, are tried in their default order.
+	Priorities map[string]int
+
 	PermissionGroupMapping map[permission.Permission][]string
 	PermissionScopeMapping map[permission.Permission][]string
 	PermissionClaimMapping map[permission.Permission][]string
@@ -57,5 +62,98 @@ type LDAPConfig struct {
 
 type KubernetesAuthConfig struct {
 	KidMappingFileLocation string
-	InvalidTokenExpiry     int64
+	// Either "directory" (the default), in which case KidMappingFileLocation is a directory containing one file
+	// per kid holding a cluster URL, or "file", in which case it's a single JSON or YAML file mapping kids to URLs.
+	KidMappingMode string
+	// How long tokens rejected by TokenReview are cached for, so that repeated attempts to use them aren't
+	// reviewed again. Zero or negative disables caching of rejected tokens.
+	InvalidTokenExpiry int64
+	// Constant prefix issuers prepend to kids that isn't part of the mapping file name.
+	// If set, it's stripped before the mapping file is looked up and tokens with kids lacking it are rejected.
+	KidPrefix string
+	// Separator splitting composite kids of the form "<cluster><separator><key id>", as issued by some issuers.
+	// If set, only the part before the first separator is used to look up the mapping; kids without it are used whole.
+	KidSeparator string
+	// If true, tokens without a kid, as issued by some legacy clusters, are reviewed against DefaultClusterURL
+	// rather than being rejected. Intended for deployments with a single cluster.
+	AllowTokensWithoutKid bool
+	// Cluster tokens without a kid are reviewed against if AllowTokensWithoutKid is set.
+	DefaultClusterURL string
+	// gRPC metadata key from which credentials are read, for proxies that can't forward "authorization".
+	// Defaults to "authorization" if empty.
+	MetadataKey string
+	// Maximum amount by which a token's issued-at time may be ahead of the current time.
+	// Tokens issued further in the future are rejected. Zero disables the check.
+	MaxIssuedAtSkew time.Duration
+	// Allowance for clock skew between token issuers and the server when checking tokens' not-before (nbf)
+	// and expiry (exp) times. Zero applies them exactly.
+	ClockSkewLeeway time.Duration
+	// Number of consecutive TokenReview failures against a cluster after which reviews against that cluster
+	// fail fast for CircuitBreakerCooldown. Zero disables the circuit breaker.
+	CircuitBreakerFailureThreshold int
+	CircuitBreakerCooldown         time.Duration
+	// Number of attempts made at a TokenReview failing with an error, e.g. because the cluster is unreachable,
+	// before giving up. Retries wait TokenReviewRetryBackoff, doubling each time. Values below 2 disable retries.
+	TokenReviewMaxAttempts  int
+	TokenReviewRetryBackoff time.Duration
+	// Maximum duration of a single TokenReview request, and of a review shared between concurrent requests for
+	// the same token, which isn't bound by any one request's deadline. Defaults to 30 seconds if zero.
+	TokenReviewTimeout time.Duration
+	// If true, usernames returned by TokenReview of the form "user|group1,group2" are split into
+	// the principal name "user" and the additional groups "group1" and "group2".
+	SplitUsernameGroups bool
+	// If true, the groups TokenReview returns for a user, such as "system:serviceaccounts", are added to the
+	// principal's groups, and so can be granted permissions. By default, they're ignored.
+	UseTokenReviewGroups bool
+	// Groups given to principals for which TokenReview returned no groups, or whose groups are ignored since
+	// UseTokenReviewGroups isn't set, e.g., "authenticated".
+	DefaultGroups []string
+	// By default, the principal's name is also one of its groups. Setting this excludes it,
+	// unless it's also among the principal's other groups.
+	ExcludeUsernameFromGroups bool
+	// By default, panics while processing credentials are recovered from and treated as a rejection.
+	// Setting this disables that recovery.
+	DisablePanicRecovery bool
+	// Cached tokens accessed when closer than this to expiry are synchronously reviewed again,
+	// keeping the cached result if the review fails. Zero disables refreshes.
+	CacheRefreshThreshold time.Duration
+	// If true, tokens without an exp claim are accepted rather than rejected. Since such tokens never expire,
+	// the result of reviewing them is cached for NonExpiringTokenCacheTTL (5 minutes if unset).
+	AllowNonExpiringTokens   bool
+	NonExpiringTokenCacheTTL time.Duration
+	// If true, token signatures are verified locally before TokenReview against a JWKS file pinned in the
+	// kid mapping directory, named after the kid's mapping file with a ".jwks" suffix.
+	// Tokens for which no such file exists, or that aren't signed by a key in it, are rejected.
+	// Not supported if KidMappingMode is "file".
+	VerifyWithStaticJWKS bool
+	// If true, tokens whose headers contain fields other than the registered JOSE header parameters
+	// (alg, kid, typ, etc.) are rejected as malformed. By default, unknown fields are ignored.
+	StrictTokenHeader bool
+	// If non-empty, tokens whose header has a typ other than one of these, e.g. "JWT", are rejected.
+	// Compared case-insensitively. Tokens without a typ, such as those Kubernetes issues, are accepted.
+	AllowedTokenTypes []string
+	// Audiences tokens are reviewed against. If non-empty, tokens are rejected unless
+	// TokenReview confirms at least one of these audiences was validated.
+	Audiences []string
+	// If true, the audiences of tokens with a given kid may be overridden by a file in the kid mapping
+	// directory, named after the kid's mapping file with a ".audiences" suffix and listing one audience
+	// per line. Tokens with no such file are reviewed against Audiences. Not supported if KidMappingMode is "file".
+	PerKidAudiences bool
+	// If true, TokenReviews of tokens with a given kid present the client certificate held in files in the kid
+	// mapping directory named after the kid's mapping file with ".crt" and ".key" suffixes, for clusters requiring
+	// mutual TLS. Kids without such files are reviewed without a client certificate.
+	// Not supported if KidMappingMode is "file".
+	PerKidClientCertificates bool
+	// If true, tokens are cached per cluster, so that the cache entries for a cluster, including rejected
+	// tokens, can be precisely invalidated. Looking tokens up in the cache then requires resolving their cluster.
+	CacheByCluster bool
+	// If non-empty, only service accounts in these namespaces may authenticate. Users that aren't service
+	// accounts, i.e. whose usernames aren't of the form "system:serviceaccount:<namespace>:<name>", are rejected.
+	AllowedNamespaces []string
+	// If positive, the number of entries in the token cache and an estimate of its size are sampled to
+	// metrics at this interval.
+	TokenCacheSampleInterval time.Duration
+	// Maximum number of distinct clusters tokens are reviewed against. Tokens whose kid maps to a cluster
+	// beyond the limit are rejected. Zero means no limit.
+	MaxDistinctClusters int
 }
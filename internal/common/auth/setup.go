@@ -4,22 +4,48 @@ import (
 	"context"
 	"errors"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/G-Research/armada/internal/common/auth/authorization"
 	"github.com/G-Research/armada/internal/common/auth/authorization/groups"
 	"github.com/G-Research/armada/internal/common/auth/configuration"
 )
 
+// Names of auth methods, used to look up their priority in configuration.AuthConfig.Priorities.
+const (
+	anonymousAuthName  = "anonymous"
+	basicAuthName      = "basic"
+	kubernetesAuthName = "kubernetes"
+	openIdAuthName     = "openid"
+	kerberosAuthName   = "kerberos"
+)
+
 func ConfigureAuth(config configuration.AuthConfig) []authorization.AuthService {
-	authServices := []authorization.AuthService{}
+	authServices := []authorization.PrioritizedAuthService{}
+	add := func(name string, service authorization.AuthService) {
+		authServices = append(authServices, authorization.PrioritizedAuthService{
+			AuthService: service,
+			Priority:    config.Priorities[name],
+		})
+	}
 
 	if len(config.BasicAuth.Users) > 0 {
-		authServices = append(authServices,
-			authorization.NewBasicAuthService(config.BasicAuth.Users))
+		add(basicAuthName, authorization.NewBasicAuthService(config.BasicAuth.Users))
 	}
 
 	if config.KubernetesAuth.KidMappingFileLocation != "" {
-		kubernetesAuthService := authorization.NewKubernetesNativeAuthService(config.KubernetesAuth)
-		authServices = append(authServices, &kubernetesAuthService)
+		kubernetesAuthService, err := authorization.NewKubernetesNativeAuthServiceWithError(config.KubernetesAuth)
+		if err != nil {
+			panic(err)
+		}
+		for _, err := range kubernetesAuthService.ValidateKidMappings() {
+			log.Warnf("kubernetes auth: %s", err)
+		}
+		if config.KubernetesAuth.TokenCacheSampleInterval > 0 {
+			// Stopped along with the service.
+			kubernetesAuthService.StartTokenCacheSampler(config.KubernetesAuth.TokenCacheSampleInterval)
+		}
+		add(kubernetesAuthName, &kubernetesAuthService)
 	}
 
 	if config.OpenIdAuth.ProviderUrl != "" {
@@ -27,11 +53,11 @@ func ConfigureAuth(config configuration.AuthConfig) []authorization.AuthService
 		if err != nil {
 			panic(err)
 		}
-		authServices = append(authServices, openIdAuthService)
+		add(openIdAuthName, openIdAuthService)
 	}
 
 	if config.AnonymousAuth {
-		authServices = append(authServices, &authorization.AnonymousAuthService{})
+		add(anonymousAuthName, &authorization.AnonymousAuthService{})
 	}
 
 	// Kerberos should be the last service as it is adding WWW-Authenticate header for unauthenticated response
@@ -45,12 +71,12 @@ func ConfigureAuth(config configuration.AuthConfig) []authorization.AuthService
 		if err != nil {
 			panic(err)
 		}
-		authServices = append(authServices, kerberosAuthService)
+		add(kerberosAuthName, kerberosAuthService)
 	}
 
 	if len(authServices) == 0 {
 		panic(errors.New("At least one auth method must be specified in config"))
 	}
 
-	return authServices
+	return authorization.SortAuthServicesByPriority(authServices)
 }
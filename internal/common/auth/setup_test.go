@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/G-Research/armada/internal/common/auth/authorization"
+	"github.com/G-Research/armada/internal/common/auth/configuration"
+)
+
+func TestConfigureAuth_KubernetesAuth(t *testing.T) {
+	kidMappingFile := filepath.Join(t.TempDir(), "kid-mapping.yaml")
+	if err := os.WriteFile(kidMappingFile, []byte("test-kid: https://cluster.test\n"), 0o644); err != nil {
+		t.Fatalf("failed to write kid mapping: %s", err)
+	}
+	config := configuration.AuthConfig{
+		KubernetesAuth: configuration.KubernetesAuthConfig{
+			KidMappingFileLocation: kidMappingFile,
+			KidMappingMode:         authorization.KidMappingModeFile,
+		},
+	}
+
+	services := ConfigureAuth(config)
+	assert.Len(t, services, 1)
+
+	// Invalid config fails startup rather than being silently ignored.
+	config.KubernetesAuth.PerKidAudiences = true
+	assert.Panics(t, func() { ConfigureAuth(config) })
+}
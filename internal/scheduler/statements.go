@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DeleteStatement returns a statement deleting the row of tableName whose key matches that of the record x,
+// together with the arguments to execute it with.
+//
+// For example, if x is an instance of a struct with definition
+//
+//	type Rectangle struct {
+//		Id     string `db:"id"`
+//		Width  int    `db:"width"`
+//		Height int    `db:"height"`
+//	},
+//
+// where Id = "foo", DeleteStatement("rectangles", []string{"id"}, x) returns
+// "DELETE FROM rectangles WHERE id=$1", ["foo"].
+//
+// Each key column must be the name of a field of x marked with a "db" tag; see NamesFromRecord.
+func DeleteStatement(tableName string, keyCols []string, x interface{}) (string, []interface{}, error) {
+	if len(keyCols) == 0 {
+		return "", nil, errors.New("at least one key column is required")
+	}
+	where, values, err := WhereFromRecordFields(x, keyCols)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", tableName, where), values, nil
+}
+
+// WhereFromRecordFields returns a WHERE clause, without the WHERE keyword, matching rows whose columns
+// named in fields equal the corresponding fields of the record x, together with the arguments for it.
+//
+// For example, if x is a Rectangle (see DeleteStatement) where Width = 3 and Height = 4,
+// WhereFromRecordFields(x, []string{"width", "height"}) returns "width=$1 AND height=$2", [3, 4].
+//
+// Each of fields must be the name of a field of x marked with a "db" tag; see NamesFromRecord.
+func WhereFromRecordFields(x interface{}, fields []string) (string, []interface{}, error) {
+	if len(fields) == 0 {
+		return "", nil, errors.New("at least one field is required")
+	}
+	values, err := valuesForColumns(fields, x)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var b strings.Builder
+	for i, field := range fields {
+		if i != 0 {
+			fmt.Fprint(&b, " AND ")
+		}
+		fmt.Fprintf(&b, "%s=$%d", field, i+1)
+	}
+	return b.String(), values, nil
+}
+
+// valuesForColumns returns the values of the fields of x marked with the "db" tags in cols, in the same order.
+func valuesForColumns(cols []string, x interface{}) ([]interface{}, error) {
+	names, values := NamesValuesFromRecord(x)
+	valuesByName := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		valuesByName[name] = values[i]
+	}
+
+	rv := make([]interface{}, len(cols))
+	for i, col := range cols {
+		value, ok := valuesByName[col]
+		if !ok {
+			return nil, errors.Errorf("column %s is not a db field of %T; valid columns are %v", col, x, names)
+		}
+		rv[i] = value
+	}
+	return rv, nil
+}
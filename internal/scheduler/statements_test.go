@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteStatement(t *testing.T) {
+	r := Record{
+		Id:      uuid.New(),
+		Value:   123,
+		Message: "abcö",
+	}
+
+	sql, args, err := DeleteStatement("records", []string{"id"}, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM records WHERE id=$1", sql)
+	assert.Equal(t, []interface{}{r.Id}, args)
+
+	sql, args, err = DeleteStatement("records", []string{"message", "value"}, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM records WHERE message=$1 AND value=$2", sql)
+	assert.Equal(t, []interface{}{r.Message, r.Value}, args)
+}
+
+func TestDeleteStatement_InvalidKeyColumns(t *testing.T) {
+	r := Record{Id: uuid.New()}
+
+	_, _, err := DeleteStatement("records", []string{"id", "notes"}, r)
+	assert.Error(t, err)
+
+	_, _, err = DeleteStatement("records", []string{}, r)
+	assert.Error(t, err)
+}
+
+func TestWhereFromRecordFields(t *testing.T) {
+	r := Record{
+		Id:      uuid.New(),
+		Value:   123,
+		Message: "abcö",
+	}
+
+	clause, args, err := WhereFromRecordFields(r, []string{"value", "id"})
+	assert.NoError(t, err)
+	assert.Equal(t, "value=$1 AND id=$2", clause)
+	assert.Equal(t, []interface{}{r.Value, r.Id}, args)
+}
+
+func TestWhereFromRecordFields_InvalidFields(t *testing.T) {
+	r := Record{Id: uuid.New()}
+
+	_, _, err := WhereFromRecordFields(r, []string{"id", "notes"})
+	assert.Error(t, err)
+
+	_, _, err = WhereFromRecordFields(r, nil)
+	assert.Error(t, err)
+}
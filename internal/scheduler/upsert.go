@@ -113,15 +113,21 @@ func CopyProtocolUpsert(ctx context.Context, tx pgx.Tx, tableName string, schema
 //	},
 //
 // it returns ["width", "height"].
+//
+// Since insert statements rely on names and values lining up, the order of the returned names is guaranteed:
+// fields are listed in declaration order, and the fields of an embedded struct without a "db" tag are
+// flattened into its parent in place of the embedded struct, recursively. For example, if x is an instance of
+//
+//	type Shape struct {
+//		Id string `db:"id"`
+//		Rectangle
+//		Colour string `db:"colour"`
+//	},
+//
+// it returns ["id", "width", "height", "colour"].
+// An embedded struct with a "db" tag is treated as a single column.
 func NamesFromRecord(x interface{}) []string {
-	t := reflect.TypeOf(x)
-	names := make([]string, 0, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		name := t.Field(i).Tag.Get("db")
-		if name != "" {
-			names = append(names, name)
-		}
-	}
+	names, _ := dbFields(reflect.TypeOf(x))
 	return names
 }
 
@@ -136,17 +142,10 @@ func NamesFromRecord(x interface{}) []string {
 //	},
 //
 // where Width = 5 and Height = 10, it returns [5, 10].
+//
+// Values are returned in the same order as the names returned by NamesFromRecord.
 func ValuesFromRecord(x interface{}) []interface{} {
-	t := reflect.TypeOf(x)
-	v := reflect.ValueOf(x)
-	values := make([]interface{}, 0, v.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		name := t.Field(i).Tag.Get("db")
-		if name != "" {
-			value := v.Field(i).Interface()
-			values = append(values, value)
-		}
-	}
+	_, values := NamesValuesFromRecord(x)
 	return values
 }
 
@@ -164,20 +163,39 @@ func ValuesFromRecord(x interface{}) []interface{} {
 // where Width = 10 and Height = 5,
 // it returns ["width", "height"], [10, 5].
 //
+// Names and values are ordered as described for NamesFromRecord.
+//
 // This function does not handle pointers to structs,
 // i.e., x must be Rectangle{} and not &Rectangle{}.
 func NamesValuesFromRecord(x interface{}) ([]string, []interface{}) {
-	t := reflect.TypeOf(x)
 	v := reflect.ValueOf(x)
+	names, indices := dbFields(v.Type())
+	values := make([]interface{}, len(indices))
+	for i, index := range indices {
+		values[i] = v.FieldByIndex(index).Interface()
+	}
+	return names, values
+}
+
+// dbFields returns the names of the fields of struct type t marked with "db" tags,
+// together with the index sequence of each for use with reflect.Value.FieldByIndex.
+// Embedded structs without a "db" tag are flattened depth-first in declaration order.
+func dbFields(t reflect.Type) ([]string, [][]int) {
 	names := make([]string, 0, t.NumField())
-	values := make([]interface{}, 0, v.NumField())
+	indices := make([][]int, 0, t.NumField())
 	for i := 0; i < t.NumField(); i++ {
-		name := t.Field(i).Tag.Get("db")
+		field := t.Field(i)
+		name := field.Tag.Get("db")
 		if name != "" {
 			names = append(names, name)
-			value := v.Field(i).Interface()
-			values = append(values, value)
+			indices = append(indices, field.Index)
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			embeddedNames, embeddedIndices := dbFields(field.Type)
+			names = append(names, embeddedNames...)
+			for _, index := range embeddedIndices {
+				indices = append(indices, append([]int{i}, index...))
+			}
 		}
 	}
-	return names, values
+	return names, indices
 }
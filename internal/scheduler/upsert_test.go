@@ -73,6 +73,50 @@ func TestNamesValuesFromRecordPointer(t *testing.T) {
 	assert.Equal(t, []interface{}{r.Id, r.Value, r.Message}, values)
 }
 
+type embeddedTimestamps struct {
+	Created  time.Time `db:"created"`
+	Modified time.Time `db:"modified"`
+}
+
+type embeddedOwner struct {
+	Owner string `db:"owner"`
+	embeddedTimestamps
+}
+
+type nestedRecord struct {
+	Id uuid.UUID `db:"id"`
+	embeddedOwner
+	Value      int                `db:"value"`
+	Notes      string             // Note no db tag
+	Timestamps embeddedTimestamps `db:"timestamps"`
+}
+
+func TestNamesValuesFromRecord_EmbeddedOrder(t *testing.T) {
+	r := nestedRecord{
+		Id: uuid.New(),
+		embeddedOwner: embeddedOwner{
+			Owner: "alice",
+			embeddedTimestamps: embeddedTimestamps{
+				Created:  time.Unix(1, 0),
+				Modified: time.Unix(2, 0),
+			},
+		},
+		Value:      123,
+		Timestamps: embeddedTimestamps{Created: time.Unix(3, 0)},
+	}
+	expectedNames := []string{"id", "owner", "created", "modified", "value", "timestamps"}
+	expectedValues := []interface{}{r.Id, "alice", time.Unix(1, 0), time.Unix(2, 0), 123, r.Timestamps}
+
+	// Repeat to guard against any dependence on map iteration order.
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expectedNames, NamesFromRecord(r))
+		assert.Equal(t, expectedValues, ValuesFromRecord(r))
+		names, values := NamesValuesFromRecord(r)
+		assert.Equal(t, expectedNames, names)
+		assert.Equal(t, expectedValues, values)
+	}
+}
+
 func withSetup(action func(queries *Queries, db *pgxpool.Pool) error) error {
 	ctx := context.Background()
 